@@ -0,0 +1,298 @@
+package catalog
+
+import (
+	"encoding/json"
+	"io"
+	"ipfs-alpha-entanglement-code/util"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// DefaultFile is the name of the catalog under the entangler config directory
+const DefaultFile = "catalog.json"
+
+// PinStatus tells whether the metadata and the parities of a file were pinned in the cluster by its upload.
+// It is empty for the files registered without being uploaded
+type PinStatus string
+
+const (
+	PinNone       PinStatus = "none"       // not entangled, nothing to pin
+	PinPinned     PinStatus = "pinned"     // metadata and parities pinned
+	PinIncomplete PinStatus = "incomplete" // the upload failed before every pin, it can be resumed
+)
+
+// Entry is a file uploaded by the entangler
+type Entry struct {
+	Name    string
+	Size    int64
+	RootCID string
+	MetaCID string `json:",omitempty"`
+
+	Alpha int
+	S     int
+	P     int
+
+	Added     time.Time
+	PinStatus PinStatus
+}
+
+// Catalog is the local list of the uploaded files, persisted as JSON and keyed by root CID.
+// It is shared by the commands and the daemon: the file is read again whenever another process changed it,
+// and each change is made under a file lock so that the processes do not overwrite each other
+type Catalog struct {
+	*sync.Mutex
+
+	path    string
+	entries map[string]Entry
+	// file last read or written
+	info os.FileInfo
+}
+
+// DefaultPath returns the path of the catalog under the entangler config directory
+func DefaultPath() (string, error) {
+	dir, err := util.ConfigDir()
+	if err != nil {
+		return "", xerrors.Errorf("fail to locate the catalog: %s", err)
+	}
+	return filepath.Join(dir, DefaultFile), nil
+}
+
+// Open loads the catalog stored at the path, the default path if empty. A missing file is an empty catalog
+func Open(path string) (*Catalog, error) {
+	if len(path) == 0 {
+		var err error
+		path, err = DefaultPath()
+		if err != nil {
+			return nil, err
+		}
+	}
+	catalog := &Catalog{Mutex: &sync.Mutex{}, path: path, entries: make(map[string]Entry)}
+	err := catalog.refresh()
+	if err != nil {
+		return nil, err
+	}
+	return catalog, nil
+}
+
+// Path returns the path of the catalog
+func (c *Catalog) Path() string {
+	return c.path
+}
+
+// Add records the file, replacing the entry of the same root CID, and saves the catalog
+func (c *Catalog) Add(entry Entry) error {
+	c.Lock()
+	defer c.Unlock()
+	unlock, err := c.lockFile()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	c.entries[entry.RootCID] = entry
+	return c.save()
+}
+
+// Remove forgets the file with the root CID and saves the catalog. It returns false if the file is unknown
+func (c *Catalog) Remove(rootCID string) (bool, error) {
+	c.Lock()
+	defer c.Unlock()
+	unlock, err := c.lockFile()
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+	if _, ok := c.entries[rootCID]; !ok {
+		return false, nil
+	}
+	delete(c.entries, rootCID)
+	return true, c.save()
+}
+
+// Get returns the entry of the file with the root CID
+func (c *Catalog) Get(rootCID string) (Entry, bool) {
+	c.Lock()
+	defer c.Unlock()
+	c.tryRefresh()
+	entry, ok := c.entries[rootCID]
+	return entry, ok
+}
+
+// Lookup finds the file whose root CID, metadata CID or name is the key.
+// The most recent upload is returned when several files have the name
+func (c *Catalog) Lookup(key string) (Entry, bool) {
+	c.Lock()
+	defer c.Unlock()
+	c.tryRefresh()
+	if entry, ok := c.entries[key]; ok {
+		return entry, true
+	}
+	var found Entry
+	var ok bool
+	for _, entry := range c.list() {
+		if entry.MetaCID == key {
+			return entry, true
+		}
+		if entry.Name == key {
+			found, ok = entry, true
+		}
+	}
+	return found, ok
+}
+
+// List returns every entry, the oldest first
+func (c *Catalog) List() []Entry {
+	c.Lock()
+	defer c.Unlock()
+	c.tryRefresh()
+	return c.list()
+}
+
+// Export writes every entry as JSON
+func (c *Catalog) Export(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	err := encoder.Encode(c.List())
+	if err != nil {
+		return xerrors.Errorf("fail to export the catalog: %s", err)
+	}
+	return nil
+}
+
+// Import adds the entries exported by another catalog and returns their number.
+// An imported entry replaces the entry of the same root CID unless it is older
+func (c *Catalog) Import(r io.Reader) (int, error) {
+	var entries []Entry
+	err := json.NewDecoder(r).Decode(&entries)
+	if err != nil {
+		return 0, xerrors.Errorf("fail to decode the imported catalog: %s", err)
+	}
+	for _, entry := range entries {
+		if len(entry.RootCID) == 0 {
+			return 0, xerrors.Errorf("fail to import the catalog: entry %q has no root CID", entry.Name)
+		}
+	}
+	c.Lock()
+	defer c.Unlock()
+	unlock, err := c.lockFile()
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	// the entries are only replaced once the catalog is saved
+	updated := make(map[string]Entry, len(c.entries)+len(entries))
+	for rootCID, entry := range c.entries {
+		updated[rootCID] = entry
+	}
+	imported := 0
+	for _, entry := range entries {
+		if current, ok := updated[entry.RootCID]; ok && current.Added.After(entry.Added) {
+			continue
+		}
+		updated[entry.RootCID] = entry
+		imported++
+	}
+	previous := c.entries
+	c.entries = updated
+	err = c.save()
+	if err != nil {
+		c.entries = previous
+		return 0, err
+	}
+	return imported, nil
+}
+
+func (c *Catalog) list() []Entry {
+	entries := make([]Entry, 0, len(c.entries))
+	for _, entry := range c.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Added.Equal(entries[j].Added) {
+			return entries[i].RootCID < entries[j].RootCID
+		}
+		return entries[i].Added.Before(entries[j].Added)
+	})
+	return entries
+}
+
+// refresh reads the catalog again if its file changed since it was last read or written
+func (c *Catalog) refresh() error {
+	return c.load(false)
+}
+
+// load reads the catalog, or only if its file changed unless forced. A missing file is left as is
+func (c *Catalog) load(force bool) error {
+	info, err := os.Stat(c.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return xerrors.Errorf("fail to read the catalog: %s", err)
+	}
+	// each save replaces the file, a change shows in its identity even within the resolution of its time
+	if !force && c.info != nil && os.SameFile(info, c.info) &&
+		info.ModTime().Equal(c.info.ModTime()) && info.Size() == c.info.Size() {
+		return nil
+	}
+
+	var entries []Entry
+	err = util.LoadJSON(c.path, &entries)
+	if err != nil {
+		return xerrors.Errorf("fail to load the catalog: %s", err)
+	}
+	c.entries = make(map[string]Entry, len(entries))
+	for _, entry := range entries {
+		c.entries[entry.RootCID] = entry
+	}
+	c.info = info
+	return nil
+}
+
+// lockFile locks the catalog file against the other processes and reads it again, before a change.
+// The file is always read since another process may have replaced it within the resolution of its time.
+// The returned function releases the lock
+func (c *Catalog) lockFile() (unlock func(), err error) {
+	release, err := util.LockFile(c.path)
+	if err != nil {
+		return nil, xerrors.Errorf("fail to lock the catalog: %s", err)
+	}
+	unlock = func() {
+		err := release()
+		if err != nil {
+			util.Default().Warn("Fail to unlock the catalog", "path", c.path, "err", err)
+		}
+	}
+	err = c.load(true)
+	if err != nil {
+		unlock()
+		return nil, err
+	}
+	return unlock, nil
+}
+
+// tryRefresh refreshes the catalog for a read, which keeps the last entries read if it fails
+func (c *Catalog) tryRefresh() {
+	err := c.refresh()
+	if err != nil {
+		util.Default().Warn("Fail to read the catalog again", "path", c.path, "err", err)
+	}
+}
+
+// save writes the catalog
+func (c *Catalog) save() error {
+	err := util.SaveJSON(c.path, c.list())
+	if err != nil {
+		return xerrors.Errorf("fail to write the catalog: %s", err)
+	}
+	info, err := os.Stat(c.path)
+	if err == nil {
+		c.info = info
+	}
+	return nil
+}
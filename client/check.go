@@ -0,0 +1,167 @@
+package client
+
+import (
+	"context"
+	"ipfs-alpha-entanglement-code/entangler"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// DefaultCheckWorkers is the default number of blocks probed concurrently by a check
+var DefaultCheckWorkers = 16
+
+// CheckOption configures the check of a file
+type CheckOption struct {
+	// number of blocks probed concurrently
+	Workers int
+
+	// data blocks considered missing, for testing
+	DataFilter []int
+}
+
+// CheckReport tells which blocks of an entangled file are missing, and whether its data can be recovered
+type CheckReport struct {
+	RootCID string
+	MetaCID string
+	Chunks  int
+
+	// data chunks and parities without any provider in IPFS
+	MissingData     []int
+	MissingParities []entangler.BlockRef
+	// missing data chunks that cannot be repaired from the available blocks
+	Unrecoverable []int
+}
+
+// Healthy returns whether every block of the file is available
+func (r *CheckReport) Healthy() bool {
+	return len(r.MissingData) == 0 && len(r.MissingParities) == 0
+}
+
+// Recoverable returns whether every data chunk is available or can be repaired
+func (r *CheckReport) Recoverable() bool {
+	return len(r.Unrecoverable) == 0
+}
+
+// Check probes the availability of every data chunk and parity of the file in IPFS, without downloading them,
+// and finds the missing chunks that cannot be repaired
+func (c *Client) Check(ctx context.Context, ref Ref, option CheckOption) (*CheckReport, error) {
+	err := c.InitIPFSConnector()
+	if err != nil {
+		return nil, err
+	}
+	ref = c.resolveRef(ctx, ref)
+	if len(ref.MetaCID) == 0 {
+		return nil, xerrors.Errorf("fail to check the file: no metafile provided: %w", ErrInvalidParameters)
+	}
+
+	lattice, metaData, err := c.openLattice(ref.MetaCID, DownloadOption{DataFilter: option.DataFilter})
+	if err != nil {
+		return nil, err
+	}
+	availability, ok := lattice.Getter.(entangler.Availability)
+	if !ok {
+		return nil, xerrors.Errorf("fail to check the file: block availability is unknown")
+	}
+
+	refs := make([]entangler.BlockRef, 0, (metaData.Alpha+1)*lattice.ChunkNum)
+	for _, index := range metaData.chunkIndexes() {
+		refs = append(refs, entangler.BlockRef{Index: index})
+	}
+	for strand := 0; strand < metaData.Alpha; strand++ {
+		for _, index := range metaData.chunkIndexes() {
+			refs = append(refs, entangler.BlockRef{Index: index, Parity: true, Strand: strand})
+		}
+	}
+	probes, err := probeBlocks(ctx, availability, refs, option.Workers)
+	if err != nil {
+		return nil, err
+	}
+
+	rootCID := ref.RootCID
+	if len(rootCID) == 0 {
+		rootCID = metaData.RootCID
+	}
+	report := &CheckReport{RootCID: rootCID, MetaCID: ref.MetaCID, Chunks: lattice.ChunkNum}
+	for _, blockRef := range refs {
+		if probes.available[blockRef] {
+			continue
+		}
+		if blockRef.Parity {
+			report.MissingParities = append(report.MissingParities, blockRef)
+		} else {
+			report.MissingData = append(report.MissingData, blockRef.Index)
+		}
+	}
+
+	// plan the repair of the missing chunks from the probed availability
+	if len(report.MissingData) > 0 {
+		plan, err := lattice.Plan(report.MissingData, probes, entangler.CostBlocks)
+		if err != nil {
+			return nil, xerrors.Errorf("fail to plan the recovery: %s", err)
+		}
+		report.Unrecoverable = plan.Unrecoverable
+		sort.Ints(report.Unrecoverable)
+	}
+	c.Logger.Info("Finish checking file", "cid", rootCID, "metacid", ref.MetaCID,
+		"missing-data", len(report.MissingData), "missing-parities", len(report.MissingParities),
+		"unrecoverable", len(report.Unrecoverable))
+
+	return report, nil
+}
+
+// probeResults is the availability of the blocks found by probing them once
+type probeResults struct {
+	available map[entangler.BlockRef]bool
+	sizes     map[entangler.BlockRef]int
+	latencies map[entangler.BlockRef]time.Duration
+}
+
+// Probe returns the recorded availability of the block
+func (p *probeResults) Probe(ref entangler.BlockRef) (bool, int, time.Duration) {
+	return p.available[ref], p.sizes[ref], p.latencies[ref]
+}
+
+// probeBlocks probes the blocks with a pool of workers
+func probeBlocks(ctx context.Context, availability entangler.Availability, refs []entangler.BlockRef,
+	workers int) (*probeResults, error) {
+
+	if workers <= 0 {
+		workers = DefaultCheckWorkers
+	}
+	results := &probeResults{
+		available: make(map[entangler.BlockRef]bool, len(refs)),
+		sizes:     make(map[entangler.BlockRef]int, len(refs)),
+		latencies: make(map[entangler.BlockRef]time.Duration, len(refs)),
+	}
+
+	var lock sync.Mutex
+	refChan := make(chan entangler.BlockRef, workers)
+	var waitGroup sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			for ref := range refChan {
+				available, size, latency := availability.Probe(ref)
+				lock.Lock()
+				results.available[ref] = available
+				results.sizes[ref] = size
+				results.latencies[ref] = latency
+				lock.Unlock()
+			}
+		}()
+	}
+	for _, ref := range refs {
+		if ctx.Err() != nil {
+			break
+		}
+		refChan <- ref
+	}
+	close(refChan)
+	waitGroup.Wait()
+
+	return results, ctx.Err()
+}
@@ -0,0 +1,180 @@
+package client
+
+import (
+	"encoding/json"
+	ipfscluster "ipfs-alpha-entanglement-code/ipfs-cluster"
+	ipfsconnector "ipfs-alpha-entanglement-code/ipfs-connector"
+	"ipfs-alpha-entanglement-code/util"
+	"sync"
+
+	"golang.org/x/xerrors"
+)
+
+type Metadata struct {
+	Alpha int
+	S     int
+	P     int
+
+	RootCID string
+
+	DataCIDIndexMap map[string]int
+	ParityCIDs      [][]string
+	ParityGroupCIDs []string   `json:",omitempty"`
+	ParityDigests   [][]string `json:",omitempty"`
+	// number of parities (or packs) of a strand in each group
+	ParityGroupSize int `json:",omitempty"`
+
+	// set instead of ParityCIDs when parities are packed
+	ParityPackCIDs  [][]string                       `json:",omitempty"`
+	ParityLocations [][]ipfsconnector.ParityLocation `json:",omitempty"`
+}
+
+// ClientOption configures the connections of a client
+type ClientOption struct {
+	// ports of the IPFS API and of the IPFS Cluster API. 0 uses the default ports
+	IPFSPort    int
+	ClusterPort int
+
+	// Logger receives the logs of the client, its connectors and its lattices. Nil uses util.Default()
+	Logger *util.Logger
+
+	// Resolve finds the metadata CID of a file from its CID, e.g. in a local catalog.
+	// It is tried before the cluster pins when a reference has no metadata. Nil only uses the cluster
+	Resolve func(rootCID string) (metaCID string, ok bool)
+}
+
+// Client uploads entangled files to IPFS and downloads, checks and repairs them.
+// The connectors are created on first use
+type Client struct {
+	*ipfsconnector.IPFSConnector
+	IPFSClusterConnector *ipfscluster.Connector
+
+	Logger *util.Logger
+
+	option ClientOption
+
+	// guards the creation of the connectors, the metadata cache and the discovered metadata CIDs
+	lock     *sync.Mutex
+	metadata map[string]*Metadata
+	metaCIDs map[string]string
+}
+
+// NewClient creates a new client for futhur use
+func NewClient(option ClientOption) (client *Client, err error) {
+	client = &Client{
+		Logger:   option.Logger,
+		option:   option,
+		lock:     &sync.Mutex{},
+		metadata: make(map[string]*Metadata),
+		metaCIDs: make(map[string]string),
+	}
+	if client.Logger == nil {
+		client.Logger = util.Default()
+	}
+
+	return client, nil
+}
+
+// init ipfs connector for future usage
+func (c *Client) InitIPFSConnector() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.IPFSConnector != nil {
+		return nil
+	}
+	conn, err := ipfsconnector.CreateIPFSConnector(c.option.IPFSPort)
+	if err != nil {
+		return xerrors.Errorf("fail to connect to IPFS: %s", err)
+	}
+	conn.Logger = c.Logger
+	c.IPFSConnector = conn
+
+	return nil
+}
+
+// init ipfs cluster connector for future usage
+func (c *Client) InitIPFSClusterConnector() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.IPFSClusterConnector != nil {
+		return nil
+	}
+	conn, err := ipfscluster.CreateIPFSClusterConnector(c.option.ClusterPort)
+	if err != nil {
+		return xerrors.Errorf("fail to connect to IPFS Cluster: %s", err)
+	}
+	conn.Logger = c.Logger
+	c.IPFSClusterConnector = conn
+
+	return nil
+}
+
+// SetLogger sets the logger of the client and of its connectors
+func (c *Client) SetLogger(logger *util.Logger) {
+	c.Logger = logger
+	if c.IPFSConnector != nil {
+		c.IPFSConnector.Logger = logger
+	}
+	if c.IPFSClusterConnector != nil {
+		c.IPFSClusterConnector.Logger = logger
+	}
+}
+
+// AddAndPinAsFile adds a file to IPFS network and pin the file in cluster with a replication factor
+// replicate = 0 means use default config in the cluster
+func (c *Client) AddAndPinAsFile(data []byte, replicate int) (cid string, err error) {
+	// upload file to IPFS network
+	cid, err = c.AddFileFromMem(data)
+	if err != nil {
+		return "", err
+	}
+
+	// pin file in cluster
+	err = c.IPFSClusterConnector.AddPin(cid, replicate)
+	return cid, err
+}
+
+// AddAndPinAsRaw adds raw data to IPFS network and pin it in cluster with a replication factor
+// replicate = 0 means use default config in the cluster
+func (c *Client) AddAndPinAsRaw(data []byte, replicate int) (cid string, err error) {
+	// upload raw bytes to IPFS network
+	cid, err = c.AddRawData(data)
+	if err != nil {
+		return "", err
+	}
+
+	// pin data in cluster
+	err = c.IPFSClusterConnector.AddPin(cid, replicate)
+	return cid, err
+}
+
+// GetMetaData downloads metafile from IPFS network and returns a metafile object.
+// Metafiles are immutable, they are cached by CID and must not be modified.
+// Undecodable or inconsistent metadata returns an error matching ErrMetadataCorrupt
+func (c *Client) GetMetaData(cid string) (metadata *Metadata, err error) {
+	c.lock.Lock()
+	metadata, ok := c.metadata[cid]
+	c.lock.Unlock()
+	if ok {
+		return metadata, nil
+	}
+
+	data, err := c.GetFileToMem(cid)
+	if err != nil {
+		return nil, err
+	}
+	var myMetadata Metadata
+	err = json.Unmarshal(data, &myMetadata)
+	if err != nil {
+		return nil, xerrors.Errorf("%s: %w", err, ErrMetadataCorrupt)
+	}
+	err = myMetadata.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	c.lock.Lock()
+	c.metadata[cid] = &myMetadata
+	c.lock.Unlock()
+	return &myMetadata, nil
+}
@@ -0,0 +1,84 @@
+package client
+
+import (
+	"context"
+	"errors"
+
+	"golang.org/x/xerrors"
+)
+
+// MetadataPinPrefix starts the name of the cluster pin of the metadata of a file, followed by the file CID
+const MetadataPinPrefix = "entangler-metadata-"
+
+// MetadataPinName returns the name of the cluster pin of the metadata of the file
+func MetadataPinName(rootCID string) string {
+	return MetadataPinPrefix + rootCID
+}
+
+// FindMetaCID finds the metadata CID of a file from its CID: with the resolver of the client, e.g. a local
+// catalog, then among the metadata pinned in the cluster under the name of the file. The metadata found in
+// the cluster must describe the file. Errors match ErrMetadataNotFound if the file has no known metadata
+func (c *Client) FindMetaCID(ctx context.Context, rootCID string) (string, error) {
+	if c.option.Resolve != nil {
+		if metaCID, ok := c.option.Resolve(rootCID); ok && len(metaCID) > 0 {
+			return metaCID, nil
+		}
+	}
+	c.lock.Lock()
+	metaCID, ok := c.metaCIDs[rootCID]
+	c.lock.Unlock()
+	if ok {
+		return metaCID, nil
+	}
+
+	err := c.InitIPFSConnector()
+	if err != nil {
+		return "", err
+	}
+	err = c.InitIPFSClusterConnector()
+	if err != nil {
+		return "", err
+	}
+	cids, err := c.IPFSClusterConnector.FindPins(MetadataPinName(rootCID))
+	if err != nil {
+		return "", xerrors.Errorf("fail to find the metadata pins: %s", err)
+	}
+	for _, cid := range cids {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		metaData, err := c.GetMetaData(cid)
+		if err != nil {
+			c.Logger.Warn("Skip unreadable metadata", "cid", rootCID, "metacid", cid, "err", err)
+			continue
+		}
+		if metaData.RootCID != rootCID {
+			c.Logger.Warn("Skip metadata of another file", "cid", rootCID, "metacid", cid)
+			continue
+		}
+		c.lock.Lock()
+		c.metaCIDs[rootCID] = cid
+		c.lock.Unlock()
+		c.Logger.Info("Found metadata in the cluster", "cid", rootCID, "metacid", cid)
+		return cid, nil
+	}
+	return "", xerrors.Errorf("no metadata of %s: %w", rootCID, ErrMetadataNotFound)
+}
+
+// resolveRef completes a reference without metadata with the metadata found from the root CID.
+// The reference is returned unchanged if none is found
+func (c *Client) resolveRef(ctx context.Context, ref Ref) Ref {
+	if len(ref.MetaCID) > 0 || len(ref.RootCID) == 0 {
+		return ref
+	}
+	metaCID, err := c.FindMetaCID(ctx, ref.RootCID)
+	switch {
+	case errors.Is(err, ErrMetadataNotFound):
+		c.Logger.Debug("No metadata found, the file cannot be recovered", "cid", ref.RootCID)
+	case err != nil:
+		c.Logger.Warn("Fail to find the metadata, the file cannot be recovered", "cid", ref.RootCID, "err", err)
+	default:
+		ref.MetaCID = metaCID
+	}
+	return ref
+}
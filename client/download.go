@@ -0,0 +1,208 @@
+package client
+
+import (
+	"context"
+	"io"
+	"ipfs-alpha-entanglement-code/entangler"
+	ipfsconnector "ipfs-alpha-entanglement-code/ipfs-connector"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// Ref identifies an entangled file by the CID of its root and the CID of its metadata.
+// Without metadata, the metadata is found from the root CID (see FindMetaCID). A file without
+// known metadata is downloaded directly and cannot be recovered
+type Ref struct {
+	RootCID string
+	MetaCID string
+}
+
+type DownloadOption struct {
+	UploadRecoverData bool
+	DataFilter        []int
+
+	// number of blocks fetched or repaired concurrently
+	Workers int
+
+	// only download the given part of the file if set
+	Range *ByteRange
+
+	// starts the repair of slow block downloads. Nil waits for the download to fail
+	Hedger entangler.Hedger
+
+	Strategy entangler.RecoveryStrategy
+
+	// maximum number of concurrent IPFS requests of the recovery. 0 uses the lattice default
+	MaxRequests int
+
+	// write the lost chunks as zeros instead of failing. They are listed in the holes of the report
+	Partial bool
+
+	// receives the bytes written out of the bytes of the file (or range) to download
+	Progress Progress
+}
+
+// ParseHedger parses the hedging policy: "off", "auto" to learn the delay from the
+// observed latencies, or a fixed delay such as "2s"
+func ParseHedger(policy string) (entangler.Hedger, error) {
+	switch policy {
+	case "off":
+		return nil, nil
+	case "auto":
+		return entangler.NewLearnedHedger(DefaultHedgeMin, DefaultHedgeMax), nil
+	}
+	delay, err := time.ParseDuration(policy)
+	if err != nil || delay <= 0 {
+		return nil, xerrors.Errorf("invalid hedging policy %q: expected off, auto or a positive duration", policy)
+	}
+	return &entangler.FixedHedger{Threshold: delay}, nil
+}
+
+// DefaultHedgeMin and DefaultHedgeMax bound the learned hedging delay
+var DefaultHedgeMin, DefaultHedgeMax = 200 * time.Millisecond, 30 * time.Second
+
+// Download streams the original file to the writer in order, repair it if the reference has metadata.
+// The report tells how the file was obtained, and is returned even if the download fails
+func (c *Client) Download(ctx context.Context, ref Ref, w io.Writer, option DownloadOption) (report *DownloadReport, err error) {
+	err = c.InitIPFSConnector()
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	ref = c.resolveRef(ctx, ref)
+	report = &DownloadReport{RootCID: ref.RootCID, MetaCID: ref.MetaCID}
+	counter := &countingWriter{w: w}
+	/* direct downloading if no metafile provided */
+	if len(ref.MetaCID) == 0 {
+		err = c.directDownload(ctx, ref.RootCID, counter, option)
+	} else {
+		err = c.metaDownload(ctx, ref.MetaCID, counter, option, report)
+	}
+	report.BytesWritten = counter.count
+	report.WallTime = time.Since(start)
+
+	return report, err
+}
+
+// directDownload interacts directly with IPFS. It fails when any data is missing
+func (c *Client) directDownload(ctx context.Context, rootCID string, w io.Writer, option DownloadOption) (err error) {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	// try to down original file using given rootCID (i.e. no metafile)
+	if option.Range != nil {
+		err = c.GetFileRangeToWriter(rootCID, option.Range.Offset, option.Range.Length, w)
+	} else {
+		err = c.GetFileToWriter(rootCID, w)
+	}
+	if err != nil {
+		return xerrors.Errorf("fail to download original file: %s", err)
+	}
+	c.Logger.Info("Finish downloading file (no recovery)", "cid", rootCID)
+
+	return nil
+}
+
+// downloadAndRecover interacts with IPFS through lattice, It launches recovery if any data is missing.
+// The DAG is walked concurrently, the leaves are written to the writer in order
+// and the blocks are released from the lattice once consumed. With a partial download,
+// the lost chunks are written as zeros and returned as holes
+func (c *Client) downloadAndRecover(ctx context.Context, lattice *entangler.Lattice, metaData *Metadata,
+	option DownloadOption, w io.Writer) (repaired bool, holes []Hole, err error) {
+
+	return newDAGWalker(ctx, c, lattice, metaData, option, w).Walk()
+}
+
+// metaDownload download metadata for recovery usage. The events of the recovery are recorded in the report
+func (c *Client) metaDownload(ctx context.Context, metaCID string, w io.Writer, option DownloadOption,
+	report *DownloadReport) (err error) {
+
+	lattice, metaData, err := c.openLattice(metaCID, option)
+	if err != nil {
+		return err
+	}
+	builder := NewReportObserver(report)
+	lattice.Observer = entangler.MultiObserver(lattice.Observer, builder)
+
+	/* download & recover file from IPFS, streaming it to the writer */
+	repaired, holes, err := c.downloadAndRecover(ctx, lattice, metaData, option, w)
+	builder.Finish()
+	report.Recovered = repaired
+	report.Holes = holes
+	if err != nil {
+		return err
+	}
+	if len(holes) > 0 {
+		c.Logger.Warn("Finish downloading file (partial)", "cid", metaData.RootCID, "holes", len(holes))
+		return nil
+	}
+	if repaired {
+		c.Logger.Info("Finish downloading file (recovered)", "cid", metaData.RootCID)
+	} else {
+		c.Logger.Info("Finish downloading file (no recovery)", "cid", metaData.RootCID)
+	}
+
+	return nil
+}
+
+// openLattice downloads the metadata and creates the lattice recovering the file
+func (c *Client) openLattice(metaCID string, option DownloadOption) (lattice *entangler.Lattice,
+	metaData *Metadata, err error) {
+
+	/* download metafile */
+	metaData, err = c.GetMetaData(metaCID)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("fail to download metaData: %w", err)
+	}
+	c.Logger.Info("Finish downloading metaFile", "metacid", metaCID)
+
+	/* create lattice */
+	// create getter
+	chunkNum := len(metaData.DataCIDIndexMap)
+	getter := ipfsconnector.CreateIPFSGetter(c.IPFSConnector, metaData.DataCIDIndexMap, metaData.ParityCIDs)
+	if len(metaData.ParityPackCIDs) > 0 {
+		getter.UsePackedParities(metaData.ParityPackCIDs, metaData.ParityLocations)
+	}
+	getter.ParityDigests = metaData.ParityDigests
+	if len(option.DataFilter) > 0 {
+		getter.DataFilter = make(map[int]struct{}, len(option.DataFilter))
+		for _, index := range option.DataFilter {
+			getter.DataFilter[index] = struct{}{}
+		}
+	}
+
+	// create lattice
+	lattice, err = entangler.NewLattice(metaData.Alpha, metaData.S, metaData.P, chunkNum, getter, 2)
+	if err != nil {
+		return nil, nil, err
+	}
+	lattice.Logger = c.Logger
+	lattice.Observer = entangler.LogObserver{Logger: c.Logger}
+	lattice.Hedger = option.Hedger
+	lattice.Strategy = option.Strategy
+	if option.MaxRequests > 0 {
+		lattice.SetConcurrency(entangler.DefaultRecoveryWorkers, option.MaxRequests)
+	}
+	lattice.Init()
+	c.Logger.Info("Finish generating lattice", "chunks", chunkNum)
+
+	return lattice, metaData, nil
+}
+
+// dataReupload re-uploads the recovered data back to IPFS
+func (c *Client) dataReupload(chunk []byte, cid string, allow bool) error {
+	if !allow {
+		return nil
+	}
+
+	uploadCID, err := c.AddRawData(chunk)
+	if err != nil {
+		return xerrors.Errorf("fail to upload the repaired chunk to IPFS: %s", err)
+	}
+	if uploadCID != cid {
+		return xerrors.Errorf("incorrect CID of the repaired chunk. Expected: %s, Got: %s", cid, uploadCID)
+	}
+	return nil
+}
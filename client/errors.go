@@ -0,0 +1,75 @@
+package client
+
+import (
+	"ipfs-alpha-entanglement-code/entangler"
+
+	"golang.org/x/xerrors"
+)
+
+var (
+	// ErrInvalidParameters is returned for invalid entanglement parameters or options
+	ErrInvalidParameters = entangler.ErrInvalidParameters
+	// ErrBlockUnrecoverable is matched by the errors of the chunks that could not be downloaded nor repaired
+	ErrBlockUnrecoverable = entangler.ErrBlockUnrecoverable
+	// ErrMetadataCorrupt is returned when the metadata cannot be decoded or does not describe a valid lattice
+	ErrMetadataCorrupt = xerrors.New("metadata corrupt")
+	// ErrMetadataNotFound is returned when no metadata of a file can be found from its CID
+	ErrMetadataNotFound = xerrors.New("metadata not found")
+)
+
+// Validate checks that the metadata describes a lattice the getter can read from without going
+// out of range. Errors match ErrMetadataCorrupt
+func (m *Metadata) Validate() error {
+	err := entangler.ValidateParameters(m.Alpha, m.S, m.P)
+	if err != nil {
+		return xerrors.Errorf("%s: %w", err, ErrMetadataCorrupt)
+	}
+
+	chunkNum := len(m.DataCIDIndexMap)
+	seen := make(map[int]struct{}, chunkNum)
+	for cid, index := range m.DataCIDIndexMap {
+		if index < 1 || index > chunkNum {
+			return xerrors.Errorf("index %d of chunk %s out of range: %w", index, cid, ErrMetadataCorrupt)
+		}
+		if _, ok := seen[index]; ok {
+			return xerrors.Errorf("duplicate chunk index %d: %w", index, ErrMetadataCorrupt)
+		}
+		seen[index] = struct{}{}
+	}
+
+	if len(m.ParityPackCIDs) > 0 || len(m.ParityLocations) > 0 {
+		if len(m.ParityPackCIDs) != m.Alpha || len(m.ParityLocations) != m.Alpha {
+			return xerrors.Errorf("expect %d strands of packed parities: %w", m.Alpha, ErrMetadataCorrupt)
+		}
+		for strand, locations := range m.ParityLocations {
+			if len(locations) != chunkNum {
+				return xerrors.Errorf("expect %d parities on strand %d, got %d: %w",
+					chunkNum, strand, len(locations), ErrMetadataCorrupt)
+			}
+			for _, location := range locations {
+				if location.Pack < 0 || location.Pack >= len(m.ParityPackCIDs[strand]) ||
+					location.Offset < 0 || location.Length < 0 {
+					return xerrors.Errorf("invalid parity location on strand %d: %w", strand, ErrMetadataCorrupt)
+				}
+			}
+		}
+	} else {
+		if len(m.ParityCIDs) != m.Alpha {
+			return xerrors.Errorf("expect %d strands of parities, got %d: %w",
+				m.Alpha, len(m.ParityCIDs), ErrMetadataCorrupt)
+		}
+		for strand, cids := range m.ParityCIDs {
+			if len(cids) != chunkNum {
+				return xerrors.Errorf("expect %d parities on strand %d, got %d: %w",
+					chunkNum, strand, len(cids), ErrMetadataCorrupt)
+			}
+		}
+	}
+
+	if len(m.ParityDigests) > 0 && len(m.ParityDigests) != m.Alpha {
+		return xerrors.Errorf("expect %d strands of parity digests, got %d: %w",
+			m.Alpha, len(m.ParityDigests), ErrMetadataCorrupt)
+	}
+
+	return nil
+}
@@ -0,0 +1,157 @@
+package client
+
+import (
+	"context"
+	"io"
+	"ipfs-alpha-entanglement-code/entangler"
+	"strconv"
+	"strings"
+
+	dag "github.com/ipfs/go-merkledag"
+	unixfs "github.com/ipfs/go-unixfs"
+	"golang.org/x/xerrors"
+)
+
+// ByteRange is the part of a file made of Length bytes starting at Offset.
+// A negative Length extends the range until the end of the file
+type ByteRange struct {
+	Offset int64
+	Length int64
+}
+
+// ParseByteRange parses a range given as "offset:length". The length can be omitted
+// (i.e. "offset:") to read until the end of the file
+func ParseByteRange(s string) (*ByteRange, error) {
+	offset, length, found := strings.Cut(s, ":")
+	if !found {
+		return nil, xerrors.Errorf("invalid range %q: expected offset:length", s)
+	}
+
+	r := &ByteRange{Length: -1}
+	var err error
+	r.Offset, err = strconv.ParseInt(offset, 10, 64)
+	if err != nil || r.Offset < 0 {
+		return nil, xerrors.Errorf("invalid range offset %q", offset)
+	}
+	if len(length) > 0 {
+		r.Length, err = strconv.ParseInt(length, 10, 64)
+		if err != nil || r.Length < 0 {
+			return nil, xerrors.Errorf("invalid range length %q", length)
+		}
+	}
+	return r, nil
+}
+
+// File is an entangled file opened for random access. Reading a part of the file only
+// downloads the blocks covering it, plus whatever the lattice needs to repair them
+type File struct {
+	client   *Client
+	lattice  *entangler.Lattice
+	metaData *Metadata
+	option   DownloadOption
+
+	root *dag.ProtoNode
+	size int64
+}
+
+// OpenFile opens the entangled file described by the metadata of the reference
+func (c *Client) OpenFile(ref Ref, option DownloadOption) (file *File, err error) {
+	err = c.InitIPFSConnector()
+	if err != nil {
+		return nil, err
+	}
+	ref = c.resolveRef(context.Background(), ref)
+	if len(ref.MetaCID) == 0 {
+		return nil, xerrors.Errorf("metadata CID is required to open a file")
+	}
+
+	lattice, metaData, err := c.openLattice(ref.MetaCID, option)
+	if err != nil {
+		return nil, err
+	}
+	file = &File{
+		client:   c,
+		lattice:  lattice,
+		metaData: metaData,
+		option:   option,
+	}
+
+	// the root holds the size of the file
+	walker := newDAGWalker(context.Background(), c, lattice, metaData, option, io.Discard)
+	root := walker.fetch(metaData.RootCID)
+	<-root.done
+	err = walker.consume(root)
+	if err == nil {
+		err = walker.releaseAll()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if root.err != nil {
+		return nil, root.err
+	}
+	fsn, err := unixfs.FSNodeFromBytes(root.node.Data())
+	if err != nil {
+		return nil, xerrors.Errorf("fail to parse file data: %s", err)
+	}
+	file.root = root.node
+	file.size = int64(fsn.FileSize())
+
+	return file, nil
+}
+
+// RootCID returns the CID of the file
+func (f *File) RootCID() string {
+	return f.metaData.RootCID
+}
+
+// Size returns the size of the file in bytes
+func (f *File) Size() int64 {
+	return f.size
+}
+
+// ReadAt reads len(p) bytes of the file starting at offset. It implements io.ReaderAt
+func (f *File) ReadAt(p []byte, offset int64) (n int, err error) {
+	if offset < 0 {
+		return 0, xerrors.Errorf("negative offset %d", offset)
+	}
+	if offset >= f.size {
+		return 0, io.EOF
+	}
+
+	buf := &sliceWriter{buf: p}
+	err = f.WriteRange(context.Background(), buf, offset, int64(len(p)))
+	if err != nil {
+		return buf.n, err
+	}
+	if buf.n < len(p) {
+		return buf.n, io.EOF
+	}
+	return buf.n, nil
+}
+
+// WriteRange streams length bytes of the file starting at offset to the writer in one walk of the DAG.
+// A negative length writes until the end of the file
+func (f *File) WriteRange(ctx context.Context, w io.Writer, offset int64, length int64) error {
+	option := f.option
+	option.Range = &ByteRange{Offset: offset, Length: length}
+	// a reader must not return zeros in place of lost data
+	option.Partial = false
+	return newDAGWalker(ctx, f.client, f.lattice, f.metaData, option, w).walkTree(f.root, 0)
+}
+
+// sliceWriter writes into a fixed slice
+type sliceWriter struct {
+	buf []byte
+	n   int
+}
+
+// Write appends the data after the bytes already written
+func (w *sliceWriter) Write(data []byte) (int, error) {
+	n := copy(w.buf[w.n:], data)
+	w.n += n
+	if n < len(data) {
+		return n, io.ErrShortWrite
+	}
+	return n, nil
+}
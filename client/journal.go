@@ -0,0 +1,447 @@
+package client
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	ipfsconnector "ipfs-alpha-entanglement-code/ipfs-connector"
+	"ipfs-alpha-entanglement-code/util"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/xerrors"
+)
+
+// JournalStep enums the steps of the upload pipeline recorded in the journal
+type JournalStep string
+
+const (
+	StepStart    JournalStep = "start"    // upload parameters
+	StepAddFile  JournalStep = "add-file" // original file added to IPFS
+	StepFlatten  JournalStep = "flatten"  // merkle tree read and flattened
+	StepParity   JournalStep = "parity"   // a single parity added to IPFS
+	StepPack     JournalStep = "pack"     // a pack of parities added to IPFS
+	StepEntangle JournalStep = "entangle" // all parities added to IPFS
+	StepGroup    JournalStep = "group"    // a group of parities linked under one DAG node
+	StepMetadata JournalStep = "metadata" // metadata added to IPFS
+	StepPin      JournalStep = "pin"      // a single CID pinned in the cluster
+)
+
+// JournalEntry is a single record of the upload journal. One entry is stored per line
+type JournalEntry struct {
+	Step JournalStep
+
+	Path     string `json:",omitempty"`
+	Size     int64  `json:",omitempty"`
+	ModTime  int64  `json:",omitempty"`
+	Alpha    int    `json:",omitempty"`
+	S        int    `json:",omitempty"`
+	P        int    `json:",omitempty"`
+	PinGroup string `json:",omitempty"`
+	PackSize int    `json:",omitempty"`
+
+	CID      string   `json:",omitempty"`
+	Strand   int      `json:",omitempty"`
+	Index    int      `json:",omitempty"`
+	BlockNum int      `json:",omitempty"`
+	Lengths  []int    `json:",omitempty"`
+	Digest   string   `json:",omitempty"`
+	Digests  []string `json:",omitempty"`
+}
+
+// UploadJournal records the completed steps of an upload on disk so that a failed upload can be resumed
+type UploadJournal struct {
+	*sync.Mutex
+
+	path string
+	file *os.File
+
+	start      JournalEntry
+	RootCID    string
+	BlockNum   int
+	Entangled  bool
+	MetaCID    string
+	parityCIDs [][]string
+	digests    [][]string
+	packCIDs   [][]string
+	packLens   [][][]int
+	groupCIDs  []string
+	pinned     map[string]struct{}
+}
+
+// DefaultJournalPath returns the journal location used for the file in the given path
+func DefaultJournalPath(path string) (string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	dir, err := util.ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	dir = filepath.Join(dir, "journal")
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.Sum256([]byte(absPath))
+	name := filepath.Base(absPath) + "-" + hex.EncodeToString(hash[:8]) + ".journal"
+	return filepath.Join(dir, name), nil
+}
+
+// OpenUploadJournal opens the journal of an upload. If the option asks for resume, the previous journal is
+// replayed and has to match the file and the entanglement parameters. Otherwise a new journal starts.
+// An empty path stands for a file read from a stream, only the entanglement parameters are matched then
+func OpenUploadJournal(journalPath string, path string, option UploadOption) (journal *UploadJournal, err error) {
+	start := JournalEntry{
+		Step:     StepStart,
+		Alpha:    option.Alpha,
+		S:        option.S,
+		P:        option.P,
+		PinGroup: string(option.PinGroup),
+		PackSize: option.PackSize,
+	}
+	if len(path) > 0 {
+		start.Path, err = filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+		info, err := os.Stat(start.Path)
+		if err != nil {
+			return nil, err
+		}
+		start.Size = info.Size()
+		start.ModTime = info.ModTime().UnixNano()
+	}
+	if option.PinGroup == PinGroupNone {
+		start.PinGroup = ""
+	}
+
+	journal = &UploadJournal{
+		Mutex:  &sync.Mutex{},
+		path:   journalPath,
+		start:  start,
+		pinned: map[string]struct{}{},
+	}
+
+	if option.Resume {
+		size, err := journal.replay()
+		if err != nil {
+			return nil, err
+		}
+		journal.file, err = os.OpenFile(journalPath, os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return nil, err
+		}
+		// drop the truncated line, the next entries are appended after the complete ones
+		err = journal.file.Truncate(size)
+		if err != nil {
+			journal.file.Close()
+			return nil, err
+		}
+		return journal, nil
+	}
+
+	journal.file, err = os.OpenFile(journalPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+	err = journal.write(start)
+	if err != nil {
+		journal.file.Close()
+		return nil, err
+	}
+	return journal, nil
+}
+
+// newMemoryJournal creates a journal that only keeps the progress in memory, for the uploads that cannot be resumed
+func newMemoryJournal(option UploadOption) *UploadJournal {
+	start := JournalEntry{Step: StepStart, Alpha: option.Alpha, S: option.S, P: option.P, PackSize: option.PackSize}
+	return &UploadJournal{Mutex: &sync.Mutex{}, start: start, pinned: map[string]struct{}{}}
+}
+
+// replay reads the previous journal and restores the progress of the upload. It returns the size of
+// the complete entries, the rest of the file being a line truncated when the upload was interrupted
+func (j *UploadJournal) replay() (int64, error) {
+	data, err := os.ReadFile(j.path)
+	if err != nil {
+		return 0, xerrors.Errorf("no journal to resume from: %s", err)
+	}
+
+	offset := 0
+	first := true
+	for offset < len(data) {
+		end := bytes.IndexByte(data[offset:], '\n')
+		if end < 0 {
+			break
+		}
+		var entry JournalEntry
+		if json.Unmarshal(data[offset:offset+end], &entry) != nil {
+			break
+		}
+		offset += end + 1
+		if first {
+			if !j.matchStart(entry) {
+				return 0, xerrors.Errorf("journal %s does not match the file or the entanglement parameters", j.path)
+			}
+			first = false
+			continue
+		}
+		j.apply(entry)
+	}
+	if first {
+		return 0, xerrors.Errorf("journal %s is empty", j.path)
+	}
+
+	return int64(offset), nil
+}
+
+// matchStart checks if the entry starts the journal of the same upload
+func (j *UploadJournal) matchStart(entry JournalEntry) bool {
+	expected, err := json.Marshal(j.start)
+	if err != nil {
+		return false
+	}
+	actual, err := json.Marshal(entry)
+	if err != nil {
+		return false
+	}
+	return string(expected) == string(actual)
+}
+
+// apply updates the progress according to the entry
+func (j *UploadJournal) apply(entry JournalEntry) {
+	switch entry.Step {
+	case StepAddFile:
+		j.RootCID = entry.CID
+	case StepFlatten:
+		j.BlockNum = entry.BlockNum
+		if j.parityCIDs == nil {
+			j.initParities(entry.BlockNum)
+		}
+	case StepParity:
+		if entry.Strand < len(j.parityCIDs) && entry.Index > 0 && entry.Index <= j.BlockNum {
+			j.parityCIDs[entry.Strand][entry.Index-1] = entry.CID
+			j.digests[entry.Strand][entry.Index-1] = entry.Digest
+		}
+	case StepPack:
+		if entry.Strand < len(j.packCIDs) && entry.Index >= 0 && entry.Index < len(j.packCIDs[entry.Strand]) {
+			j.packCIDs[entry.Strand][entry.Index] = entry.CID
+			j.packLens[entry.Strand][entry.Index] = entry.Lengths
+			first := entry.Index * j.start.PackSize
+			for i, digest := range entry.Digests {
+				if first+i < j.BlockNum {
+					j.digests[entry.Strand][first+i] = digest
+				}
+			}
+		}
+	case StepEntangle:
+		j.Entangled = true
+	case StepGroup:
+		if entry.Index == len(j.groupCIDs) {
+			j.groupCIDs = append(j.groupCIDs, entry.CID)
+		}
+	case StepMetadata:
+		j.MetaCID = entry.CID
+	case StepPin:
+		j.pinned[entry.CID] = struct{}{}
+	case StepStart:
+	}
+}
+
+// initParities allocates the parity (or pack) slots of the flattened tree
+func (j *UploadJournal) initParities(blockNum int) {
+	alpha := j.start.Alpha
+	j.parityCIDs = make([][]string, alpha)
+	j.digests = make([][]string, alpha)
+	for k := range j.parityCIDs {
+		j.parityCIDs[k] = make([]string, blockNum)
+		j.digests[k] = make([]string, blockNum)
+	}
+
+	if j.start.PackSize > 0 {
+		packNum := (blockNum + j.start.PackSize - 1) / j.start.PackSize
+		j.packCIDs = make([][]string, alpha)
+		j.packLens = make([][][]int, alpha)
+		for k := 0; k < alpha; k++ {
+			j.packCIDs[k] = make([]string, packNum)
+			j.packLens[k] = make([][]int, packNum)
+		}
+	}
+}
+
+// write appends the entry to the journal file, if any
+func (j *UploadJournal) write(entry JournalEntry) error {
+	if j.file == nil {
+		return nil
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	_, err = j.file.Write(append(line, '\n'))
+	return err
+}
+
+// record appends the entry to the journal and updates the progress
+func (j *UploadJournal) record(entry JournalEntry) error {
+	j.Lock()
+	defer j.Unlock()
+
+	err := j.write(entry)
+	if err != nil {
+		return xerrors.Errorf("could not write upload journal: %s", err)
+	}
+	j.apply(entry)
+	return nil
+}
+
+// RecordFile records that the original file is added to IPFS
+func (j *UploadJournal) RecordFile(cid string) error {
+	return j.record(JournalEntry{Step: StepAddFile, CID: cid})
+}
+
+// RecordFlatten records the number of blocks in the flattened merkle tree.
+// It fails if a resumed upload finds a different tree
+func (j *UploadJournal) RecordFlatten(blockNum int) error {
+	if j.BlockNum != 0 {
+		if j.BlockNum != blockNum {
+			return xerrors.Errorf("merkle tree has %d blocks but %d are journaled", blockNum, j.BlockNum)
+		}
+		return nil
+	}
+	return j.record(JournalEntry{Step: StepFlatten, BlockNum: blockNum})
+}
+
+// RecordParity records that the parity with the given index on the strand is added to IPFS
+func (j *UploadJournal) RecordParity(strand int, index int, cid string, digest string) error {
+	return j.record(JournalEntry{Step: StepParity, Strand: strand, Index: index, CID: cid, Digest: digest})
+}
+
+// RecordPack records that the index-th pack on the strand is added to IPFS
+// with the lengths and the digests of its parities
+func (j *UploadJournal) RecordPack(strand int, index int, cid string, lengths []int, digests []string) error {
+	return j.record(JournalEntry{Step: StepPack, Strand: strand, Index: index, CID: cid,
+		Lengths: lengths, Digests: digests})
+}
+
+// RecordEntangle records that all the parities are added to IPFS
+func (j *UploadJournal) RecordEntangle() error {
+	return j.record(JournalEntry{Step: StepEntangle})
+}
+
+// RecordGroup records the DAG node linking the index-th group of parities
+func (j *UploadJournal) RecordGroup(index int, cid string) error {
+	return j.record(JournalEntry{Step: StepGroup, Index: index, CID: cid})
+}
+
+// RecordMetadata records that the metadata is added to IPFS
+func (j *UploadJournal) RecordMetadata(cid string) error {
+	return j.record(JournalEntry{Step: StepMetadata, CID: cid})
+}
+
+// RecordPin records that the CID is pinned in the cluster
+func (j *UploadJournal) RecordPin(cid string) error {
+	return j.record(JournalEntry{Step: StepPin, CID: cid})
+}
+
+// ParityCIDs returns a copy of the journaled parity CIDs. Missing parities are empty strings
+func (j *UploadJournal) ParityCIDs() [][]string {
+	j.Lock()
+	defer j.Unlock()
+
+	parityCIDs := make([][]string, len(j.parityCIDs))
+	for k := range j.parityCIDs {
+		parityCIDs[k] = append([]string{}, j.parityCIDs[k]...)
+	}
+	return parityCIDs
+}
+
+// ParityDigests returns a copy of the journaled parity digests
+func (j *UploadJournal) ParityDigests() [][]string {
+	j.Lock()
+	defer j.Unlock()
+
+	digests := make([][]string, len(j.digests))
+	for k := range j.digests {
+		digests[k] = append([]string{}, j.digests[k]...)
+	}
+	return digests
+}
+
+// PackCIDs returns a copy of the journaled pack CIDs. Missing packs are empty strings
+func (j *UploadJournal) PackCIDs() [][]string {
+	j.Lock()
+	defer j.Unlock()
+
+	packCIDs := make([][]string, len(j.packCIDs))
+	for k := range j.packCIDs {
+		packCIDs[k] = append([]string{}, j.packCIDs[k]...)
+	}
+	return packCIDs
+}
+
+// StorageCIDs returns the CIDs of the objects storing the parities, i.e. the packs if parities are packed
+func (j *UploadJournal) StorageCIDs() [][]string {
+	if j.start.PackSize > 0 {
+		return j.PackCIDs()
+	}
+	return j.ParityCIDs()
+}
+
+// ParityLocations returns where each parity is stored in the journaled packs
+func (j *UploadJournal) ParityLocations() [][]ipfsconnector.ParityLocation {
+	j.Lock()
+	defer j.Unlock()
+
+	locations := make([][]ipfsconnector.ParityLocation, len(j.packLens))
+	for k, packs := range j.packLens {
+		locations[k] = make([]ipfsconnector.ParityLocation, 0, j.BlockNum)
+		for pack, lengths := range packs {
+			offset := 0
+			for _, length := range lengths {
+				locations[k] = append(locations[k],
+					ipfsconnector.ParityLocation{Pack: pack, Offset: offset, Length: length})
+				offset += length
+			}
+		}
+	}
+	return locations
+}
+
+// GroupCIDs returns a copy of the journaled CIDs of the parity groups
+func (j *UploadJournal) GroupCIDs() []string {
+	j.Lock()
+	defer j.Unlock()
+
+	return append([]string{}, j.groupCIDs...)
+}
+
+// IsPinned checks if the CID is already pinned in a previous attempt
+func (j *UploadJournal) IsPinned(cid string) bool {
+	j.Lock()
+	defer j.Unlock()
+
+	_, ok := j.pinned[cid]
+	return ok
+}
+
+// Close closes the journal file and keeps it on disk for a later resume
+func (j *UploadJournal) Close() error {
+	if j.file == nil {
+		return nil
+	}
+	return j.file.Close()
+}
+
+// Remove closes and deletes the journal once the upload finishes
+func (j *UploadJournal) Remove() error {
+	if j.file == nil {
+		return nil
+	}
+	j.file.Close()
+	return os.Remove(j.path)
+}
@@ -0,0 +1,242 @@
+package client
+
+import (
+	"context"
+	"ipfs-alpha-entanglement-code/entangler"
+	"sort"
+	"sync"
+
+	"golang.org/x/xerrors"
+)
+
+// DefaultMinPinPeers is the number of cluster peers a pin must be held by when none is given
+var DefaultMinPinPeers = 1
+
+// PinReport tells how the cluster pins of an entangled file are replicated
+type PinReport struct {
+	// number of cluster peers holding each pin of the file: the metadata, and the parities,
+	// their packs or their groups
+	Peers map[string]int
+	// pins held by fewer peers than required
+	Degraded []string
+}
+
+// MaintainOption configures the maintenance of a file
+type MaintainOption struct {
+	// missing blocks tolerated before repairing the file. 0 repairs the first missing block
+	MaxMissing int
+
+	// cluster peers a pin must be held by, it is pinned again below. 0 uses DefaultMinPinPeers
+	MinPinPeers int
+
+	// number of blocks probed, repaired or pins checked concurrently
+	Workers int
+
+	Strategy entangler.RecoveryStrategy
+}
+
+// MaintainReport tells what the maintenance of a file found and did
+type MaintainReport struct {
+	Pins  *PinReport
+	Check *CheckReport
+	// nil if the file was not repaired
+	Repair *RepairReport
+	// pins added again to the cluster
+	Repinned []string
+}
+
+// Maintain keeps an entangled file available: it checks the cluster pins of the file and the availability
+// of its blocks, repairs the missing blocks once more than the tolerated number are missing, and pins
+// the degraded pins and the repaired parities again. The report is returned even if a step fails
+func (c *Client) Maintain(ctx context.Context, ref Ref, option MaintainOption) (report *MaintainReport, err error) {
+	err = c.InitIPFSClusterConnector()
+	if err != nil {
+		return nil, err
+	}
+	report = &MaintainReport{}
+	report.Pins, err = c.CheckPins(ctx, ref, option.MinPinPeers, option.Workers)
+	if err != nil {
+		return report, err
+	}
+	report.Check, err = c.Check(ctx, ref, CheckOption{Workers: option.Workers})
+	if err != nil {
+		return report, err
+	}
+
+	repin := make(map[string]struct{}, len(report.Pins.Degraded))
+	for _, cid := range report.Pins.Degraded {
+		repin[cid] = struct{}{}
+	}
+	var repairErr error
+	if len(report.Check.MissingData)+len(report.Check.MissingParities) > option.MaxMissing {
+		report.Repair, repairErr = c.repairChecked(ctx, ref, report.Check,
+			DownloadOption{Workers: option.Workers, Strategy: option.Strategy})
+		if report.Repair != nil {
+			metaData, err := c.GetMetaData(ref.MetaCID)
+			if err != nil {
+				return report, err
+			}
+			// a repaired parity is only stored by this node until the cluster pins it again
+			for _, block := range report.Repair.ParitiesRepaired {
+				if cid, ok := metaData.ParityPinCID(block); ok {
+					repin[cid] = struct{}{}
+				}
+			}
+		}
+	}
+
+	for cid := range repin {
+		report.Repinned = append(report.Repinned, cid)
+	}
+	sort.Strings(report.Repinned)
+	err = c.Repin(ctx, ref.MetaCID, report.Repinned)
+	if err != nil {
+		return report, err
+	}
+	return report, repairErr
+}
+
+// CheckPins gets the number of cluster peers holding each pin of the file, with a pool of workers.
+// A pin is degraded when it is held by fewer than minPeers peers
+func (c *Client) CheckPins(ctx context.Context, ref Ref, minPeers int, workers int) (*PinReport, error) {
+	if len(ref.MetaCID) == 0 {
+		return nil, xerrors.Errorf("fail to check the pins: no metafile provided: %w", ErrInvalidParameters)
+	}
+	if minPeers <= 0 {
+		minPeers = DefaultMinPinPeers
+	}
+	if workers <= 0 {
+		workers = DefaultCheckWorkers
+	}
+	err := c.InitIPFSConnector()
+	if err != nil {
+		return nil, err
+	}
+	err = c.InitIPFSClusterConnector()
+	if err != nil {
+		return nil, err
+	}
+	metaData, err := c.GetMetaData(ref.MetaCID)
+	if err != nil {
+		return nil, xerrors.Errorf("fail to download metaData: %w", err)
+	}
+
+	cids := append([]string{ref.MetaCID}, metaData.pinCIDs()...)
+	report := &PinReport{Peers: make(map[string]int, len(cids))}
+	var lock sync.Mutex
+	var pinErr error
+	cidChan := make(chan string, workers)
+	var waitGroup sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			for cid := range cidChan {
+				peers, err := c.IPFSClusterConnector.PinPeers(cid)
+				lock.Lock()
+				if err != nil && pinErr == nil {
+					pinErr = xerrors.Errorf("fail to get the pin status of %s: %s", cid, err)
+				}
+				report.Peers[cid] = peers
+				lock.Unlock()
+			}
+		}()
+	}
+	for _, cid := range cids {
+		if ctx.Err() != nil {
+			break
+		}
+		cidChan <- cid
+	}
+	close(cidChan)
+	waitGroup.Wait()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if pinErr != nil {
+		return nil, pinErr
+	}
+
+	for _, cid := range cids {
+		if report.Peers[cid] < minPeers {
+			report.Degraded = append(report.Degraded, cid)
+		}
+	}
+	c.Logger.Info("Finish checking pins", "metacid", ref.MetaCID, "pins", len(cids), "degraded", len(report.Degraded))
+	return report, nil
+}
+
+// Repin pins the CIDs of the file again in the cluster: the metadata with the default replication factor
+// under the name of the file, and the parities, packs or groups on the next cluster peer like an upload
+func (c *Client) Repin(ctx context.Context, metaCID string, cids []string) error {
+	err := c.InitIPFSClusterConnector()
+	if err != nil {
+		return err
+	}
+	for _, cid := range cids {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		replicate, name := 1, ""
+		if cid == metaCID {
+			replicate = 0
+			metaData, err := c.GetMetaData(metaCID)
+			if err != nil {
+				return xerrors.Errorf("fail to download metaData: %w", err)
+			}
+			name = MetadataPinName(metaData.RootCID)
+		}
+		err = c.IPFSClusterConnector.AddNamedPin(cid, name, replicate)
+		if err != nil {
+			return xerrors.Errorf("could not pin %s again: %s", cid, err)
+		}
+		c.Logger.Info("Pin again", "cid", cid)
+	}
+	return nil
+}
+
+// pinCIDs returns the CIDs pinned by the upload besides the metadata: the groups if parities are
+// grouped, otherwise every pack or every single parity
+func (m *Metadata) pinCIDs() []string {
+	if len(m.ParityGroupCIDs) > 0 {
+		return m.ParityGroupCIDs
+	}
+	storage := m.ParityCIDs
+	if len(m.ParityPackCIDs) > 0 {
+		storage = m.ParityPackCIDs
+	}
+	cids := make([]string, 0)
+	for _, strandCIDs := range storage {
+		cids = append(cids, strandCIDs...)
+	}
+	return cids
+}
+
+// ParityPinCID returns the CID of the pin holding the parity: its group, its pack or the parity itself.
+// The group is unknown if the metadata has several groups per strand but no group size
+func (m *Metadata) ParityPinCID(block entangler.BlockRef) (string, bool) {
+	storage, object := m.ParityCIDs, block.Index-1
+	if len(m.ParityPackCIDs) > 0 {
+		storage, object = m.ParityPackCIDs, m.ParityLocations[block.Strand][block.Index-1].Pack
+	}
+	if len(m.ParityGroupCIDs) == 0 {
+		return storage[block.Strand][object], true
+	}
+
+	// the groups of a strand follow the groups of the previous strands
+	size := m.ParityGroupSize
+	if size == 0 {
+		if len(m.ParityGroupCIDs) != len(storage) {
+			return "", false
+		}
+		return m.ParityGroupCIDs[block.Strand], true
+	}
+	group := object / size
+	for strand := 0; strand < block.Strand; strand++ {
+		group += (len(storage[strand]) + size - 1) / size
+	}
+	if group >= len(m.ParityGroupCIDs) {
+		return "", false
+	}
+	return m.ParityGroupCIDs[group], true
+}
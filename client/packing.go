@@ -0,0 +1,189 @@
+package client
+
+import (
+	"ipfs-alpha-entanglement-code/entangler"
+	"sync"
+
+	"golang.org/x/xerrors"
+)
+
+// parityStore uploads the parities output by the entangler into storage objects
+type parityStore interface {
+	// Missing returns the number of parities still to be uploaded
+	Missing() int
+	// Add uploads the parity, or buffers it until its storage object is complete.
+	// It returns the number of parities uploaded by the call
+	Add(block entangler.EntangledBlock) (int, error)
+	// Objects returns the CIDs of the storage objects on each strand. It fails if any is missing
+	Objects() ([][]string, error)
+}
+
+// newParityStore creates the store matching the packing option of the upload
+func (c *Client) newParityStore(option UploadOption, journal *UploadJournal) parityStore {
+	if option.PackSize > 0 {
+		return &packedParityStore{
+			Mutex:    &sync.Mutex{},
+			client:   c,
+			journal:  journal,
+			packSize: option.PackSize,
+			blockNum: journal.BlockNum,
+			packCIDs: journal.PackCIDs(),
+			pending:  map[[2]int]*pendingPack{},
+		}
+	}
+	return &singleParityStore{client: c, journal: journal, parityCIDs: journal.ParityCIDs()}
+}
+
+// singleParityStore uploads every parity as its own IPFS file
+type singleParityStore struct {
+	client     *Client
+	journal    *UploadJournal
+	parityCIDs [][]string
+}
+
+func (st *singleParityStore) Missing() (missing int) {
+	for k := range st.parityCIDs {
+		for _, parity := range st.parityCIDs[k] {
+			if len(parity) == 0 {
+				missing++
+			}
+		}
+	}
+	return missing
+}
+
+func (st *singleParityStore) Add(block entangler.EntangledBlock) (int, error) {
+	if len(st.parityCIDs[block.Strand][block.LeftBlockIndex-1]) > 0 {
+		// already uploaded in a previous attempt
+		return 0, nil
+	}
+
+	// upload file to IPFS network
+	blockCID, err := st.client.AddFileFromMem(block.Data)
+	if err == nil {
+		digest := entangler.ParityDigest(block.Data)
+		err = st.journal.RecordParity(int(block.Strand), block.LeftBlockIndex, blockCID, digest)
+	}
+	if err != nil {
+		return 0, err
+	}
+	// each parity has its own slot, no lock needed
+	st.parityCIDs[block.Strand][block.LeftBlockIndex-1] = blockCID
+	return 1, nil
+}
+
+func (st *singleParityStore) Objects() ([][]string, error) {
+	for k := range st.parityCIDs {
+		for i, parity := range st.parityCIDs[k] {
+			if len(parity) == 0 {
+				return nil, xerrors.Errorf("could not upload parity %d on strand %d", i, k)
+			}
+		}
+	}
+	return st.parityCIDs, nil
+}
+
+// pendingPack buffers the parities of a pack until all of them are generated
+type pendingPack struct {
+	parities [][]byte
+	count    int
+}
+
+// packedParityStore concatenates contiguous parities of a strand and uploads them as one IPFS file
+type packedParityStore struct {
+	*sync.Mutex
+
+	client   *Client
+	journal  *UploadJournal
+	packSize int
+	blockNum int
+	packCIDs [][]string
+	pending  map[[2]int]*pendingPack
+}
+
+// packLen returns the number of parities in the pack. The last pack of a strand may be shorter
+func (st *packedParityStore) packLen(pack int) int {
+	if (pack+1)*st.packSize > st.blockNum {
+		return st.blockNum - pack*st.packSize
+	}
+	return st.packSize
+}
+
+func (st *packedParityStore) Missing() (missing int) {
+	st.Lock()
+	defer st.Unlock()
+
+	for k := range st.packCIDs {
+		for pack, packCID := range st.packCIDs[k] {
+			if len(packCID) == 0 {
+				missing += st.packLen(pack)
+			}
+		}
+	}
+	return missing
+}
+
+func (st *packedParityStore) Add(block entangler.EntangledBlock) (int, error) {
+	strand := int(block.Strand)
+	pack := (block.LeftBlockIndex - 1) / st.packSize
+
+	// buffer the parity until the pack is complete. The wrapping parities of a strand come last
+	st.Lock()
+	if len(st.packCIDs[strand][pack]) > 0 {
+		// already uploaded in a previous attempt
+		st.Unlock()
+		return 0, nil
+	}
+	key := [2]int{strand, pack}
+	pending, ok := st.pending[key]
+	if !ok {
+		pending = &pendingPack{parities: make([][]byte, st.packLen(pack))}
+		st.pending[key] = pending
+	}
+	pending.parities[(block.LeftBlockIndex-1)%st.packSize] = block.Data
+	pending.count++
+	complete := pending.count == len(pending.parities)
+	if complete {
+		delete(st.pending, key)
+	}
+	st.Unlock()
+	if !complete {
+		return 0, nil
+	}
+
+	// upload the pack and remember the parity lengths to locate them later
+	lengths := make([]int, len(pending.parities))
+	digests := make([]string, len(pending.parities))
+	data := make([]byte, 0)
+	for i, parity := range pending.parities {
+		lengths[i] = len(parity)
+		digests[i] = entangler.ParityDigest(parity)
+		data = append(data, parity...)
+	}
+	packCID, err := st.client.AddFileFromMem(data)
+	if err == nil {
+		err = st.journal.RecordPack(strand, pack, packCID, lengths, digests)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	st.Lock()
+	st.packCIDs[strand][pack] = packCID
+	st.Unlock()
+	return len(lengths), nil
+}
+
+func (st *packedParityStore) Objects() ([][]string, error) {
+	st.Lock()
+	defer st.Unlock()
+
+	for k := range st.packCIDs {
+		for i, packCID := range st.packCIDs[k] {
+			if len(packCID) == 0 {
+				return nil, xerrors.Errorf("could not upload parity pack %d on strand %d", i, k)
+			}
+		}
+	}
+	return st.packCIDs, nil
+}
@@ -0,0 +1,78 @@
+package client
+
+import (
+	"golang.org/x/xerrors"
+)
+
+// PinGroupMode defines how parities are grouped under pinnable DAG nodes
+type PinGroupMode string
+
+const (
+	PinGroupNone   PinGroupMode = "none"   // pin every parity on its own
+	PinGroupStrand PinGroupMode = "strand" // one group per strand
+	PinGroupWindow PinGroupMode = "window" // one group per lattice window (s*p parities) of a strand
+)
+
+// MaxGroupLinks bounds the number of parities in a group so that the group node fits in one block
+var MaxGroupLinks = 1024
+
+// groupSize returns the number of parities in the groups of the mode, 0 if parities are not grouped
+func groupSize(mode PinGroupMode, s int, p int) (int, error) {
+	switch mode {
+	case PinGroupStrand:
+		return MaxGroupLinks, nil
+	case PinGroupWindow:
+		if s*p > MaxGroupLinks {
+			return MaxGroupLinks, nil
+		}
+		return s * p, nil
+	case PinGroupNone, "":
+		return 0, nil
+	}
+	return 0, xerrors.Errorf("invalid pin group mode %s", mode)
+}
+
+// groupParities splits the parities of each strand into groups according to the mode.
+// A group never mixes parities of different strands
+func groupParities(parityCIDs [][]string, mode PinGroupMode, s int, p int) (groups [][]string, err error) {
+	size, err := groupSize(mode, s, p)
+	if err != nil || size == 0 {
+		return nil, err
+	}
+
+	for _, strandCIDs := range parityCIDs {
+		for start := 0; start < len(strandCIDs); start += size {
+			end := start + size
+			if end > len(strandCIDs) {
+				end = len(strandCIDs)
+			}
+			groups = append(groups, strandCIDs[start:end])
+		}
+	}
+	return groups, nil
+}
+
+// addParityGroups links each group of parities under one DAG node and records the node in the journal
+func (c *Client) addParityGroups(parityCIDs [][]string, option UploadOption,
+	journal *UploadJournal) (groupCIDs []string, err error) {
+
+	groups, err := groupParities(parityCIDs, option.PinGroup, option.S, option.P)
+	if err != nil {
+		return nil, err
+	}
+
+	groupCIDs = journal.GroupCIDs()
+	for i := len(groupCIDs); i < len(groups); i++ {
+		groupCID, err := c.AddLinkNode(groups[i])
+		if err != nil {
+			return nil, xerrors.Errorf("could not add parity group %d: %s", i, err)
+		}
+		err = journal.RecordGroup(i, groupCID)
+		if err != nil {
+			return nil, err
+		}
+		groupCIDs = append(groupCIDs, groupCID)
+	}
+
+	return groupCIDs, nil
+}
@@ -0,0 +1,45 @@
+package client
+
+import (
+	"context"
+	"ipfs-alpha-entanglement-code/entangler"
+
+	"golang.org/x/xerrors"
+)
+
+// Plan computes the cheapest recovery of the whole file under the cost model, from the availability
+// of its blocks in IPFS. The blocks are probed, nothing is downloaded
+func (c *Client) Plan(ref Ref, option DownloadOption, model entangler.CostModel) (*entangler.RecoveryPlan, error) {
+	err := c.InitIPFSConnector()
+	if err != nil {
+		return nil, err
+	}
+	ref = c.resolveRef(context.Background(), ref)
+	if len(ref.MetaCID) == 0 {
+		return nil, xerrors.Errorf("fail to plan the recovery: no metafile provided")
+	}
+
+	lattice, metaData, err := c.openLattice(ref.MetaCID, option)
+	if err != nil {
+		return nil, err
+	}
+	availability, ok := lattice.Getter.(entangler.Availability)
+	if !ok {
+		return nil, xerrors.Errorf("fail to plan the recovery: block availability is unknown")
+	}
+
+	plan, err := lattice.Plan(metaData.chunkIndexes(), availability, model)
+	if err != nil {
+		return nil, xerrors.Errorf("fail to plan the recovery: %s", err)
+	}
+	return plan, nil
+}
+
+// chunkIndexes returns the lattice indexes of all the data chunks of the file
+func (m *Metadata) chunkIndexes() []int {
+	indexes := make([]int, len(m.DataCIDIndexMap))
+	for i := range indexes {
+		indexes[i] = i + 1
+	}
+	return indexes
+}
@@ -0,0 +1,76 @@
+package client
+
+import (
+	"fmt"
+	"ipfs-alpha-entanglement-code/util"
+	"sync"
+	"time"
+)
+
+// Progress receives the progress of a stage of an operation: the units done out of the total of the
+// stage, 0 if unknown. It is called concurrently and must not block
+type Progress func(stage string, done int64, total int64)
+
+// throughput reports the progress and the throughput of a batch of block operations
+type throughput struct {
+	*sync.Mutex
+
+	logger   *util.Logger
+	progress Progress
+
+	name     string
+	total    int
+	done     int
+	reported int
+	start    time.Time
+}
+
+// newThroughput creates a reporter for the given number of operations. The progress is optional
+func newThroughput(logger *util.Logger, name string, total int, progress Progress) *throughput {
+	return &throughput{
+		Mutex:    &sync.Mutex{},
+		logger:   logger,
+		progress: progress,
+		name:     name,
+		total:    total,
+		start:    time.Now(),
+	}
+}
+
+// Add counts n finished operations and reports the progress every 10 percent
+func (t *throughput) Add(n int) {
+	t.Lock()
+	defer t.Unlock()
+
+	t.done += n
+	if n == 0 || t.total == 0 {
+		return
+	}
+	if t.progress != nil {
+		t.progress(t.name, int64(t.done), int64(t.total))
+	}
+	percent := t.done * 100 / t.total
+	if percent/10 > t.reported/10 {
+		t.reported = percent
+		t.logger.Info(t.name, "done", t.done, "total", t.total, "percent", percent,
+			"rate", fmt.Sprintf("%.1f blocks/s", t.rate()))
+	}
+}
+
+// Finish reports the overall throughput
+func (t *throughput) Finish() {
+	t.Lock()
+	defer t.Unlock()
+
+	t.logger.Info(t.name, "done", t.done, "elapsed", time.Since(t.start).Round(time.Millisecond),
+		"rate", fmt.Sprintf("%.1f blocks/s", t.rate()))
+}
+
+// rate returns the number of finished operations per second
+func (t *throughput) rate() float64 {
+	elapsed := time.Since(t.start).Seconds()
+	if elapsed == 0 {
+		return 0
+	}
+	return float64(t.done) / elapsed
+}
@@ -0,0 +1,167 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"ipfs-alpha-entanglement-code/entangler"
+
+	"golang.org/x/xerrors"
+)
+
+// RepairReport tells which missing blocks of a file were repaired and published back to IPFS
+type RepairReport struct {
+	Check *CheckReport
+
+	DataRepaired     []int
+	ParitiesRepaired []entangler.BlockRef
+	// missing blocks that could not be repaired or published
+	Failed []entangler.BlockRef
+}
+
+// Repair checks the file, rebuilds its missing data chunks and parities through the lattice and adds them
+// back to IPFS with their original CIDs. The repaired blocks are stored by the connected IPFS node.
+// The report is returned even if some blocks fail, the error then matches ErrBlockUnrecoverable
+func (c *Client) Repair(ctx context.Context, ref Ref, option DownloadOption) (report *RepairReport, err error) {
+	err = c.InitIPFSConnector()
+	if err != nil {
+		return nil, err
+	}
+	ref = c.resolveRef(ctx, ref)
+	check, err := c.Check(ctx, ref, CheckOption{Workers: option.Workers, DataFilter: option.DataFilter})
+	if err != nil {
+		return nil, err
+	}
+	return c.repairChecked(ctx, ref, check, option)
+}
+
+// repairChecked repairs the missing blocks found by the check of the file
+func (c *Client) repairChecked(ctx context.Context, ref Ref, check *CheckReport,
+	option DownloadOption) (report *RepairReport, err error) {
+
+	report = &RepairReport{Check: check}
+	if check.Healthy() {
+		return report, nil
+	}
+
+	lattice, metaData, err := c.openLattice(ref.MetaCID, option)
+	if err != nil {
+		return report, err
+	}
+	indexCIDs := make(map[int]string, len(metaData.DataCIDIndexMap))
+	for cid, index := range metaData.DataCIDIndexMap {
+		indexCIDs[index] = cid
+	}
+
+	var lastErr error
+	fail := func(block entangler.BlockRef, err error) {
+		c.Logger.Warn("Fail to repair block", "block", block, "err", err)
+		report.Failed = append(report.Failed, block)
+		lastErr = &entangler.RecoveryError{Block: block, Err: err}
+	}
+
+	/* repair the data chunks */
+
+	for _, index := range check.MissingData {
+		if ctx.Err() != nil {
+			return report, ctx.Err()
+		}
+		block := entangler.BlockRef{Index: index}
+		chunk, _, err := lattice.GetChunkContext(ctx, index)
+		if err == nil {
+			err = c.dataReupload(chunk, indexCIDs[index], true)
+		}
+		if err != nil {
+			fail(block, err)
+			continue
+		}
+		report.DataRepaired = append(report.DataRepaired, index)
+	}
+
+	/* repair the parities, or the packs storing them */
+
+	if len(metaData.ParityPackCIDs) > 0 {
+		packs := make(map[[2]int][]entangler.BlockRef)
+		order := make([][2]int, 0)
+		for _, block := range check.MissingParities {
+			key := [2]int{block.Strand, metaData.ParityLocations[block.Strand][block.Index-1].Pack}
+			if _, ok := packs[key]; !ok {
+				order = append(order, key)
+			}
+			packs[key] = append(packs[key], block)
+		}
+		for _, key := range order {
+			if ctx.Err() != nil {
+				return report, ctx.Err()
+			}
+			err := c.repairPack(ctx, lattice, metaData, key[0], key[1])
+			if err != nil {
+				for _, block := range packs[key] {
+					fail(block, err)
+				}
+				continue
+			}
+			report.ParitiesRepaired = append(report.ParitiesRepaired, packs[key]...)
+		}
+	} else {
+		for _, block := range check.MissingParities {
+			if ctx.Err() != nil {
+				return report, ctx.Err()
+			}
+			parity, _, err := lattice.GetParityContext(ctx, block.Index, block.Strand)
+			if err == nil {
+				err = c.parityReupload([][]byte{parity, bytes.TrimRight(parity, "\x00")},
+					metaData.ParityCIDs[block.Strand][block.Index-1])
+			}
+			if err != nil {
+				fail(block, err)
+				continue
+			}
+			report.ParitiesRepaired = append(report.ParitiesRepaired, block)
+		}
+	}
+
+	c.Logger.Info("Finish repairing file", "cid", check.RootCID, "data", len(report.DataRepaired),
+		"parities", len(report.ParitiesRepaired), "failed", len(report.Failed))
+	if len(report.Failed) > 0 {
+		return report, xerrors.Errorf("fail to repair %d blocks, last: %w", len(report.Failed), lastErr)
+	}
+	return report, nil
+}
+
+// repairPack rebuilds every parity of the pack and adds the pack back to IPFS
+func (c *Client) repairPack(ctx context.Context, lattice *entangler.Lattice, metaData *Metadata,
+	strand int, pack int) error {
+
+	data := make([]byte, 0)
+	for i, location := range metaData.ParityLocations[strand] {
+		if location.Pack != pack {
+			continue
+		}
+		parity, _, err := lattice.GetParityContext(ctx, i+1, strand)
+		if err != nil {
+			return err
+		}
+		// the recovered parity may be padded or trimmed, the pack keeps its original length
+		original := make([]byte, location.Length)
+		copy(original, parity)
+		data = append(data, original...)
+	}
+
+	return c.parityReupload([][]byte{data}, metaData.ParityPackCIDs[strand][pack])
+}
+
+// parityReupload adds the first candidate matching the CID of the parity (or pack) back to IPFS
+func (c *Client) parityReupload(candidates [][]byte, cid string) error {
+	var uploadCID string
+	var err error
+	for _, candidate := range candidates {
+		uploadCID, err = c.AddFileFromMem(candidate)
+		if err != nil {
+			return xerrors.Errorf("fail to upload the repaired parity to IPFS: %s", err)
+		}
+		if uploadCID == cid {
+			return nil
+		}
+	}
+	return xerrors.Errorf("incorrect CID of the repaired parity. Expected: %s, Got: %s", cid, uploadCID)
+}
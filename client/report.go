@@ -0,0 +1,172 @@
+package client
+
+import (
+	"encoding/json"
+	"io"
+	"ipfs-alpha-entanglement-code/entangler"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// BlockRepair is a block repaired during the download
+type BlockRepair struct {
+	Block entangler.BlockRef
+	Left  entangler.BlockRef
+	Right entangler.BlockRef
+	// number of repairs between the chunk requested by the download and this block
+	Depth int
+}
+
+// DownloadReport summarizes what a download did to get the file
+type DownloadReport struct {
+	RootCID string
+	// metadata used to recover the file, found from the root CID if not given
+	MetaCID string `json:",omitempty"`
+	Output  string
+
+	// whether any data chunk was repaired
+	Recovered bool
+	// lattice indexes of the data chunks downloaded and repaired
+	DataFetched  []int
+	DataRepaired []int
+	// parities downloaded and repaired
+	ParitiesFetched  []entangler.BlockRef
+	ParitiesRepaired []entangler.BlockRef
+	// repairs in the order they finished, and the number of repair levels needed
+	Repairs       []BlockRepair
+	RecoveryDepth int
+
+	Downloads       int
+	FailedDownloads int
+	BytesDownloaded int64
+	BytesRepaired   int64
+	BytesWritten    int64
+	WallTime        time.Duration
+
+	// byte ranges of the file filled with zeros by a partial download
+	Holes []Hole
+}
+
+// WriteReport writes the report as JSON to the given path
+func WriteReport(path string, report *DownloadReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return xerrors.Errorf("fail to encode download report: %s", err)
+	}
+	err = os.WriteFile(path, data, 0600)
+	if err != nil {
+		return xerrors.Errorf("fail to write download report: %s", err)
+	}
+	return nil
+}
+
+// ReportObserver builds the report of a download from the events of its lattice
+type ReportObserver struct {
+	sync.Mutex
+
+	report           *DownloadReport
+	dataFetched      map[int]struct{}
+	dataRepaired     map[int]struct{}
+	paritiesFetched  map[entangler.BlockRef]struct{}
+	paritiesRepaired map[entangler.BlockRef]struct{}
+}
+
+// NewReportObserver starts the report of a download
+func NewReportObserver(report *DownloadReport) *ReportObserver {
+	return &ReportObserver{
+		report:           report,
+		dataFetched:      map[int]struct{}{},
+		dataRepaired:     map[int]struct{}{},
+		paritiesFetched:  map[entangler.BlockRef]struct{}{},
+		paritiesRepaired: map[entangler.BlockRef]struct{}{},
+	}
+}
+
+// Observe records the event in the report
+func (b *ReportObserver) Observe(event entangler.Event) {
+	b.Lock()
+	defer b.Unlock()
+
+	block := event.Block
+	switch event.Type {
+	case entangler.EventDownloadSuccess:
+		b.report.Downloads++
+		b.report.BytesDownloaded += int64(event.Size)
+		if block.Parity {
+			b.paritiesFetched[block] = struct{}{}
+		} else {
+			b.dataFetched[block.Index] = struct{}{}
+		}
+	case entangler.EventDownloadFail:
+		b.report.Downloads++
+		b.report.FailedDownloads++
+	case entangler.EventRepairSuccess:
+		b.report.BytesRepaired += int64(event.Size)
+		b.report.Repairs = append(b.report.Repairs, BlockRepair{
+			Block: block,
+			Left:  event.Left,
+			Right: event.Right,
+			Depth: event.Depth,
+		})
+		if event.Depth+1 > b.report.RecoveryDepth {
+			b.report.RecoveryDepth = event.Depth + 1
+		}
+		if block.Parity {
+			b.paritiesRepaired[block] = struct{}{}
+		} else {
+			b.dataRepaired[block.Index] = struct{}{}
+		}
+	}
+}
+
+// Finish sorts the recorded blocks into the report
+func (b *ReportObserver) Finish() {
+	b.Lock()
+	defer b.Unlock()
+
+	b.report.DataFetched = sortedIndexes(b.dataFetched)
+	b.report.DataRepaired = sortedIndexes(b.dataRepaired)
+	b.report.ParitiesFetched = sortedRefs(b.paritiesFetched)
+	b.report.ParitiesRepaired = sortedRefs(b.paritiesRepaired)
+}
+
+// sortedIndexes returns the indexes of the set in order
+func sortedIndexes(set map[int]struct{}) []int {
+	indexes := make([]int, 0, len(set))
+	for index := range set {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	return indexes
+}
+
+// sortedRefs returns the blocks of the set by strand, then by index
+func sortedRefs(set map[entangler.BlockRef]struct{}) []entangler.BlockRef {
+	refs := make([]entangler.BlockRef, 0, len(set))
+	for ref := range set {
+		refs = append(refs, ref)
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		if refs[i].Strand != refs[j].Strand {
+			return refs[i].Strand < refs[j].Strand
+		}
+		return refs[i].Index < refs[j].Index
+	})
+	return refs
+}
+
+// countingWriter counts the bytes written to the file
+type countingWriter struct {
+	w     io.Writer
+	count int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.count += int64(n)
+	return n, err
+}
@@ -0,0 +1,471 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"ipfs-alpha-entanglement-code/entangler"
+	ipfsconnector "ipfs-alpha-entanglement-code/ipfs-connector"
+	"ipfs-alpha-entanglement-code/util"
+	"os"
+	"sync"
+
+	"golang.org/x/xerrors"
+)
+
+type UploadOption struct {
+	Alpha int
+	S     int
+	P     int
+
+	Resume      bool
+	JournalPath string
+
+	AddWorkers int
+	PinWorkers int
+	PinGroup   PinGroupMode
+
+	// PackSize > 0 packs this number of contiguous parities of a strand into one storage object
+	PackSize int
+
+	// receives the bytes of the file added, then the parities uploaded and pinned
+	Progress Progress
+}
+
+// DefaultAddWorkers and DefaultPinWorkers are the sizes of the worker pools used when none is given
+var (
+	DefaultAddWorkers = 8
+	DefaultPinWorkers = 4
+)
+
+// UploadResult holds the CIDs added by an upload
+type UploadResult struct {
+	RootCID string
+	// empty if the file is not entangled
+	MetaCID string
+}
+
+// Upload adds the file read from the reader to IPFS, generates and uploads its entanglement, and waits for
+// the metadata and the parities to be pinned in the cluster. The progress is recorded in the journal of the
+// option if any, so that a failed upload can be resumed. A resumed upload skips the steps already journaled,
+// the reader must thus provide the same file. The CIDs already added are returned even if the upload fails
+func (c *Client) Upload(ctx context.Context, r io.Reader, option UploadOption) (result UploadResult, err error) {
+	if option.Resume && len(option.JournalPath) == 0 {
+		return result, xerrors.Errorf("could not resume a streamed upload without journal: %w", ErrInvalidParameters)
+	}
+	journal := newMemoryJournal(option)
+	if len(option.JournalPath) > 0 {
+		journal, err = OpenUploadJournal(option.JournalPath, "", option)
+		if err != nil {
+			return result, xerrors.Errorf("could not open upload journal: %s", err)
+		}
+	}
+
+	return c.upload(ctx, journal, option, func() (string, error) {
+		return c.AddReader(&progressReader{r: r, progress: option.Progress})
+	})
+}
+
+// UploadFile uploads the file in the given path like Upload. The journal is always kept, by default
+// under the entangler config directory, and is matched against the file on resume
+func (c *Client) UploadFile(ctx context.Context, path string, option UploadOption) (result UploadResult, err error) {
+	journalPath := option.JournalPath
+	if len(journalPath) == 0 {
+		journalPath, err = DefaultJournalPath(path)
+		if err != nil {
+			return result, xerrors.Errorf("could not locate upload journal: %s", err)
+		}
+	}
+	journal, err := OpenUploadJournal(journalPath, path, option)
+	if err != nil {
+		return result, xerrors.Errorf("could not open upload journal: %s", err)
+	}
+	if option.Resume {
+		c.Logger.Info("Resume upload from journal", "journal", journalPath)
+	}
+
+	return c.upload(ctx, journal, option, func() (string, error) {
+		file, err := os.Open(path)
+		if err != nil {
+			return "", err
+		}
+		defer file.Close()
+		info, err := file.Stat()
+		if err != nil {
+			return "", err
+		}
+		return c.AddReader(&progressReader{r: file, progress: option.Progress, total: info.Size()})
+	})
+}
+
+// upload runs the steps of the upload not recorded in the journal yet. The journal is removed once the
+// upload succeeds and closed otherwise
+func (c *Client) upload(ctx context.Context, journal *UploadJournal, option UploadOption,
+	addFile func() (string, error)) (result UploadResult, err error) {
+
+	defer func() {
+		if err != nil {
+			journal.Close()
+		}
+	}()
+	if option.Alpha > 0 {
+		err = entangler.ValidateParameters(option.Alpha, option.S, option.P)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	// init ipfs connector. Fail the whole process if no connection built
+	err = c.InitIPFSConnector()
+	if err != nil {
+		return result, err
+	}
+
+	/* add original file to ipfs */
+
+	result.RootCID = journal.RootCID
+	if len(result.RootCID) == 0 {
+		rootCID, err := addFile()
+		if err != nil {
+			return result, xerrors.Errorf("could not add File to IPFS: %s", err)
+		}
+		result.RootCID = rootCID
+		err = journal.RecordFile(rootCID)
+		if err != nil {
+			return result, err
+		}
+	}
+	c.Logger.Info("Finish adding file to IPFS", "cid", result.RootCID)
+	if option.Alpha < 1 {
+		// expect no entanglement
+		return result, journal.Remove()
+	}
+
+	result.MetaCID = journal.MetaCID
+	if len(result.MetaCID) == 0 {
+		result.MetaCID, err = c.uploadEntanglementAndMetadata(ctx, result.RootCID, option, journal)
+		if err != nil {
+			return result, err
+		}
+	}
+	c.Logger.Info("Finish uploading metadata", "cid", result.RootCID, "metacid", result.MetaCID)
+
+	// pin the groups if parities are grouped, otherwise every single parity
+	pinCIDs := journal.GroupCIDs()
+	if len(pinCIDs) == 0 {
+		for _, strandCIDs := range journal.StorageCIDs() {
+			pinCIDs = append(pinCIDs, strandCIDs...)
+		}
+	}
+
+	// init cluster connector. Delay th fail after all uploading to IPFS finishes
+	err = c.InitIPFSClusterConnector()
+	if err != nil {
+		return result, err
+	}
+
+	/* pin files in cluster */
+
+	err = c.pinMetadataAndParities(ctx, result.RootCID, result.MetaCID, pinCIDs, journal, option.PinWorkers, option.Progress)
+	if err != nil {
+		return result, err
+	}
+
+	return result, journal.Remove()
+}
+
+// uploadEntanglementAndMetadata flattens the merkle tree, uploads the parities and the metadata
+func (c *Client) uploadEntanglementAndMetadata(ctx context.Context, rootCID string, option UploadOption,
+	journal *UploadJournal) (metaCID string, err error) {
+
+	alpha, s, p := option.Alpha, option.S, option.P
+
+	/* get merkle tree from IPFS and flatten the tree */
+
+	root, err := c.GetMerkleTree(rootCID, &entangler.Lattice{})
+	if err != nil {
+		return "", xerrors.Errorf("could not read merkle tree: %s", err)
+	}
+	nodes := root.GetFlattenedTree(s, p, true)
+	blockNum := len(nodes)
+	if c.Logger.Enabled(util.LevelDebug) {
+		sequence := make([]int, len(nodes))
+		for i, node := range nodes {
+			sequence[i] = node.PreOrderIdx
+		}
+		c.Logger.Debug("Flatten merkle tree", "nodes", blockNum, "sequence", sequence)
+	}
+	err = journal.RecordFlatten(blockNum)
+	if err != nil {
+		return "", err
+	}
+	c.Logger.Info("Finish reading and flattening file's merkle tree from IPFS", "nodes", blockNum)
+
+	/* generate entanglement */
+
+	objectCIDs, err := c.generateEntanglementAndUpload(ctx, option, nodes, journal)
+	if err != nil {
+		return "", err
+	}
+
+	/* group parities for pinning */
+
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+
+	groupCIDs, err := c.addParityGroups(objectCIDs, option, journal)
+	if err != nil {
+		return "", err
+	}
+
+	/* Store Metatdata */
+
+	cidMap := make(map[string]int)
+	for i, node := range nodes {
+		cidMap[node.CID] = i + 1
+	}
+	metaData := Metadata{
+		Alpha:           alpha,
+		S:               s,
+		P:               p,
+		RootCID:         rootCID,
+		DataCIDIndexMap: cidMap,
+		ParityGroupCIDs: groupCIDs,
+		ParityDigests:   journal.ParityDigests(),
+	}
+	if len(groupCIDs) > 0 {
+		metaData.ParityGroupSize, err = groupSize(option.PinGroup, s, p)
+		if err != nil {
+			return "", err
+		}
+	}
+	if option.PackSize > 0 {
+		metaData.ParityPackCIDs = objectCIDs
+		metaData.ParityLocations = journal.ParityLocations()
+	} else {
+		metaData.ParityCIDs = objectCIDs
+	}
+	rawMetadata, err := json.Marshal(metaData)
+	if err != nil {
+		return "", xerrors.Errorf("could not marshal metadata: %s", err)
+	}
+	metaCID, err = c.AddFileFromMem(rawMetadata)
+	if err != nil {
+		return "", xerrors.Errorf("could not upload metadata: %s", err)
+	}
+
+	err = journal.RecordMetadata(metaCID)
+	return metaCID, err
+}
+
+// generateLattice takes a slice of flattened tree as well as alpha, s, p to perform alpha entanglement.
+// Parities are uploaded by a pool of workers, one by one or in packs. It returns the CIDs of the storage
+// objects on each strand. Parities already recorded in the journal are not uploaded again
+func (c *Client) generateEntanglementAndUpload(ctx context.Context, option UploadOption,
+	nodes []*ipfsconnector.TreeNode, journal *UploadJournal) ([][]string, error) {
+
+	alpha, s, p := option.Alpha, option.S, option.P
+
+	// all parities are uploaded in a previous attempt
+	if journal.Entangled {
+		return journal.StorageCIDs(), nil
+	}
+
+	// the first failed upload stops the entanglement
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// bounded channels make the entangler wait for the workers
+	workers := option.AddWorkers
+	if workers < 1 {
+		workers = DefaultAddWorkers
+	}
+	dataChan := make(chan []byte, workers)
+	parityChan := make(chan entangler.EntangledBlock, workers)
+
+	// start the entangler to read from pipline
+	tangler, err := entangler.NewEntangler(alpha, s, p)
+	if err != nil {
+		return nil, err
+	}
+	tangler.Logger = c.Logger
+	entangleErr := make(chan error, 1)
+	go func() {
+		entangleErr <- tangler.Entangle(dataChan, parityChan)
+	}()
+
+	// send data to entangler. The entanglement of a partial sequence is discarded
+	dataErr := make(chan error, 1)
+	go func() {
+		defer close(dataChan)
+		for _, node := range nodes {
+			if ctx.Err() != nil {
+				dataErr <- ctx.Err()
+				return
+			}
+			nodeData, err := node.Data()
+			if err != nil {
+				dataErr <- xerrors.Errorf("could not read data of node %s: %s", node.CID, err)
+				return
+			}
+			dataChan <- nodeData
+		}
+		dataErr <- nil
+	}()
+
+	/* store parity blocks using the worker pool */
+
+	store := c.newParityStore(option, journal)
+	progress := newThroughput(c.Logger, "Uploading parities", store.Missing(), option.Progress)
+
+	var lock sync.Mutex
+	var addErr error
+	var waitGroupAdd sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		waitGroupAdd.Add(1)
+		go func() {
+			defer waitGroupAdd.Done()
+
+			for block := range parityChan {
+				if ctx.Err() != nil {
+					// drain the entangler
+					continue
+				}
+				uploaded, err := store.Add(block)
+				if err != nil {
+					lock.Lock()
+					if addErr == nil {
+						addErr = xerrors.Errorf("could not upload parity %d on strand %d: %w",
+							block.LeftBlockIndex, block.Strand, err)
+					}
+					lock.Unlock()
+					cancel()
+					continue
+				}
+				progress.Add(uploaded)
+			}
+		}()
+	}
+	waitGroupAdd.Wait()
+	progress.Finish()
+	if addErr != nil {
+		// the entangler returns once the data sender stops
+		<-entangleErr
+		<-dataErr
+		return nil, addErr
+	}
+
+	// the parity channel is closed once the entangler returns
+	err = <-entangleErr
+	if err != nil {
+		return nil, xerrors.Errorf("could not generate entanglement: %s", err)
+	}
+	err = <-dataErr
+	if err != nil {
+		return nil, err
+	}
+
+	// check if all parity blocks are added successfully
+	objectCIDs, err := store.Objects()
+	if err != nil {
+		return nil, err
+	}
+	for k := 0; k < alpha; k++ {
+		c.Logger.Info("Finish uploading entanglement", "strand", k)
+	}
+
+	err = journal.RecordEntangle()
+	return objectCIDs, err
+}
+
+// pinMetadataAndParities pins the metadata and parities (or groups of parities) in IPFS cluster
+// and waits for the pins. The metadata is pinned under the name of the file, so that it can be found
+// from the file CID. Parities are pinned by a pool of workers, each one allocated to the next
+// cluster peer. CIDs pinned in a previous attempt are skipped
+func (c *Client) pinMetadataAndParities(ctx context.Context, rootCID string, metaCID string, parityCIDs []string,
+	journal *UploadJournal, workers int, reporter Progress) error {
+
+	if workers < 1 {
+		workers = DefaultPinWorkers
+	}
+
+	var lock sync.Mutex
+	var pinErr error
+	setErr := func(err error) {
+		lock.Lock()
+		defer lock.Unlock()
+		if pinErr == nil {
+			pinErr = err
+		}
+	}
+	hasErr := func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return pinErr != nil
+	}
+
+	pin := func(cid string, name string, replicate int) error {
+		if journal.IsPinned(cid) {
+			return nil
+		}
+		err := c.IPFSClusterConnector.AddNamedPin(cid, name, replicate)
+		if err == nil {
+			err = journal.RecordPin(cid)
+		}
+		return err
+	}
+
+	err := pin(metaCID, MetadataPinName(rootCID), 0)
+	if err != nil {
+		return xerrors.Errorf("could not pin metadata: %s", err)
+	}
+
+	// feed the workers until the first failure
+	cidChan := make(chan string, workers)
+	progress := newThroughput(c.Logger, "Pinning parities", len(parityCIDs), reporter)
+	var waitGroupWorker sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		waitGroupWorker.Add(1)
+		go func() {
+			defer waitGroupWorker.Done()
+			for cid := range cidChan {
+				err := pin(cid, "", 1)
+				if err != nil {
+					setErr(xerrors.Errorf("could not pin parity %s: %s", cid, err))
+					continue
+				}
+				progress.Add(1)
+			}
+		}()
+	}
+	for i := 0; i < len(parityCIDs) && !hasErr(); i++ {
+		if ctx.Err() != nil {
+			setErr(ctx.Err())
+			break
+		}
+		cidChan <- parityCIDs[i]
+	}
+	close(cidChan)
+	waitGroupWorker.Wait()
+	progress.Finish()
+
+	return pinErr
+}
+
+// progressReader reports the bytes read from the file being added
+type progressReader struct {
+	r        io.Reader
+	progress Progress
+	read     int64
+	total    int64
+}
+
+func (pr *progressReader) Read(p []byte) (int, error) {
+	n, err := pr.r.Read(p)
+	pr.read += int64(n)
+	if pr.progress != nil && n > 0 {
+		pr.progress("Adding file", pr.read, pr.total)
+	}
+	return n, err
+}
@@ -0,0 +1,383 @@
+package client
+
+import (
+	"context"
+	"io"
+	"ipfs-alpha-entanglement-code/entangler"
+	"math"
+	"sync"
+
+	dag "github.com/ipfs/go-merkledag"
+	unixfs "github.com/ipfs/go-unixfs"
+	"golang.org/x/xerrors"
+)
+
+// DefaultDownloadWorkers is the default number of blocks fetched or repaired concurrently during download
+var DefaultDownloadWorkers = 8
+
+// nodeFuture is a DAG node being fetched (or repaired) through the lattice
+type nodeFuture struct {
+	done chan struct{}
+	node *dag.ProtoNode
+	err  error
+	// the chunk could not be recovered
+	lost bool
+	// index of the chunk in the lattice, 0 if the CID is not in the metadata
+	index int
+}
+
+// Hole is a byte range of the file that could not be recovered, filled with zeros by a partial download
+type Hole struct {
+	Offset int64
+	Length int64
+	// CID of the lost block. The hole covers the whole subtree of the block within the range
+	CID string
+}
+
+// dagWalker traverses the DAG of the file concurrently and writes the leaves to the writer in order.
+// Every internal node prefetches a sliding window of its children, while the number of blocks
+// fetched at the same time is bounded by the number of workers.
+// Only the children covering the byte range [start, end) are fetched, using the UnixFS block sizes.
+// With a partial download, the lost subtrees are written as zeros and recorded as holes.
+// The chunks are released from the lattice once no pending fetch can need them for a repair
+type dagWalker struct {
+	*sync.Mutex
+
+	ctx      context.Context
+	client   *Client
+	lattice  *entangler.Lattice
+	metaData *Metadata
+	option   DownloadOption
+	w        io.Writer
+
+	workers  chan struct{}
+	window   int
+	repaired bool
+	holes    []Hole
+
+	// fetches started and not consumed yet per chunk index, and the consumed chunks still in the lattice
+	pending  map[int]int
+	consumed []int
+	last     int
+
+	start int64
+	end   int64
+
+	// bytes written out of the bytes to download, known once the root is fetched
+	written int64
+	total   int64
+}
+
+// newDAGWalker creates a walker with the fan-out given in the option
+func newDAGWalker(ctx context.Context, c *Client, lattice *entangler.Lattice, metaData *Metadata,
+	option DownloadOption, w io.Writer) *dagWalker {
+
+	workers := option.Workers
+	if workers <= 0 {
+		workers = DefaultDownloadWorkers
+	}
+	start, end := int64(0), int64(math.MaxInt64)
+	if option.Range != nil {
+		start = option.Range.Offset
+		if option.Range.Length >= 0 {
+			end = start + option.Range.Length
+		}
+	}
+	return &dagWalker{
+		Mutex:    &sync.Mutex{},
+		ctx:      ctx,
+		client:   c,
+		lattice:  lattice,
+		metaData: metaData,
+		option:   option,
+		w:        w,
+		workers:  make(chan struct{}, workers),
+		window:   workers,
+		pending:  make(map[int]int),
+		start:    start,
+		end:      end,
+	}
+}
+
+// Walk fetches the whole DAG from the root and returns whether any block was repaired,
+// and the holes left by a partial download
+func (d *dagWalker) Walk() (repaired bool, holes []Hole, err error) {
+	root := d.fetch(d.metaData.RootCID)
+	<-root.done
+	err = d.consume(root)
+	if err != nil {
+		return false, nil, err
+	}
+	if root.err != nil {
+		// the size of the file is unknown without its root
+		return false, nil, root.err
+	}
+	fsn, err := unixfs.FSNodeFromBytes(root.node.Data())
+	if err != nil {
+		return false, nil, xerrors.Errorf("fail to parse file data: %s", err)
+	}
+	if size := int64(fsn.FileSize()); size < d.end {
+		d.total = size - d.start
+	} else {
+		d.total = d.end - d.start
+	}
+	if d.total < 0 {
+		d.total = 0
+	}
+	err = d.walkTree(root.node, 0)
+
+	d.Lock()
+	defer d.Unlock()
+	return d.repaired, d.holes, err
+}
+
+// walkTree walks the DAG under the node. The fetches still in flight when it returns are cancelled,
+// and the chunks kept for the pending fetches are released
+func (d *dagWalker) walkTree(node *dag.ProtoNode, offset int64) (err error) {
+	ctx, cancel := context.WithCancel(d.ctx)
+	defer cancel()
+	d.ctx = ctx
+	defer func() {
+		releaseErr := d.releaseAll()
+		if err == nil {
+			err = releaseErr
+		}
+	}()
+
+	return d.walk(node, offset)
+}
+
+// walk writes the data under the node starting at the offset of the file, restricted to the range
+func (d *dagWalker) walk(node *dag.ProtoNode, offset int64) error {
+	fsn, err := unixfs.FSNodeFromBytes(node.Data())
+	if err != nil {
+		return xerrors.Errorf("fail to parse file data: %s", err)
+	}
+	err = d.write(fsn.Data(), offset)
+	if err != nil {
+		return err
+	}
+
+	// select the children covering the range
+	links := node.Links()
+	if len(links) != fsn.NumChildren() {
+		return xerrors.Errorf("inconsistent node: %d links for %d block sizes", len(links), fsn.NumChildren())
+	}
+	cids := make([]string, 0, len(links))
+	offsets := make([]int64, 0, len(links))
+	sizes := make([]int64, 0, len(links))
+	childOffset := offset + int64(len(fsn.Data()))
+	for i, link := range links {
+		size := int64(fsn.BlockSize(i))
+		if childOffset < d.end && childOffset+size > d.start {
+			cids = append(cids, link.Cid.String())
+			offsets = append(offsets, childOffset)
+			sizes = append(sizes, size)
+		}
+		childOffset += size
+	}
+
+	// keep a window of children in flight and consume them in order
+	pending := make([]*nodeFuture, 0, d.window)
+	next := 0
+	for i := range cids {
+		for ; next < len(cids) && len(pending) < d.window; next++ {
+			pending = append(pending, d.fetch(cids[next]))
+		}
+		child := pending[0]
+		pending = pending[1:]
+
+		<-child.done
+		if d.ctx.Err() != nil {
+			return d.ctx.Err()
+		}
+		err = d.consume(child)
+		if err != nil {
+			return err
+		}
+		if child.err != nil {
+			if !child.lost || !d.option.Partial {
+				return child.err
+			}
+			err = d.skip(cids[i], offsets[i], sizes[i])
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		err = d.walk(child.node, offsets[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// write writes the part of the data at the offset of the file that lies in the range
+func (d *dagWalker) write(data []byte, offset int64) error {
+	low, high := int64(0), int64(len(data))
+	if d.start > offset {
+		low = d.start - offset
+	}
+	if d.end-offset < high {
+		high = d.end - offset
+	}
+	if low >= high {
+		return nil
+	}
+
+	_, err := d.w.Write(data[low:high])
+	if err != nil {
+		return xerrors.Errorf("fail to write file data: %s", err)
+	}
+	d.report(high - low)
+	return nil
+}
+
+// report records the bytes written. The leaves are written in order by a single goroutine
+func (d *dagWalker) report(n int64) {
+	d.written += n
+	if d.option.Progress != nil {
+		d.option.Progress("Downloading", d.written, d.total)
+	}
+}
+
+// skip writes zeros in place of the lost subtree and records it as a hole
+func (d *dagWalker) skip(cid string, offset int64, size int64) error {
+	low, high := offset, offset+size
+	if d.start > low {
+		low = d.start
+	}
+	if d.end < high {
+		high = d.end
+	}
+	d.client.Logger.Warn("Lost block filled with zeros", "cid", cid, "offset", low, "length", high-low)
+	d.Lock()
+	d.holes = append(d.holes, Hole{Offset: low, Length: high - low, CID: cid})
+	d.Unlock()
+
+	zeros := make([]byte, 32*1024)
+	for remaining := high - low; remaining > 0; {
+		n := int64(len(zeros))
+		if remaining < n {
+			n = remaining
+		}
+		_, err := d.w.Write(zeros[:n])
+		if err != nil {
+			return xerrors.Errorf("fail to write file data: %s", err)
+		}
+		d.report(n)
+		remaining -= n
+	}
+	return nil
+}
+
+// fetch gets the node asynchronously once a worker is available
+func (d *dagWalker) fetch(cid string) *nodeFuture {
+	future := &nodeFuture{done: make(chan struct{}), index: d.metaData.DataCIDIndexMap[cid]}
+	d.Lock()
+	d.pending[future.index]++
+	d.Unlock()
+	go func() {
+		defer close(future.done)
+
+		d.workers <- struct{}{}
+		defer func() { <-d.workers }()
+		future.node, future.lost, future.err = d.getNode(cid)
+	}()
+
+	return future
+}
+
+// consume records that the fetched node has been used and releases the consumed chunks left behind
+// the fetches. The nodes are consumed in pre-order, so that any later fetch is for a chunk after the
+// last consumed one. A chunk is only entangled with the chunks of its lattice window, so that the
+// chunks more than a window before every pending or later fetch cannot serve a repair anymore
+func (d *dagWalker) consume(future *nodeFuture) error {
+	d.Lock()
+	defer d.Unlock()
+
+	d.pending[future.index]--
+	if d.pending[future.index] == 0 {
+		delete(d.pending, future.index)
+	}
+	if future.err != nil {
+		return nil
+	}
+	d.consumed = append(d.consumed, future.index)
+	if future.index > d.last {
+		d.last = future.index
+	}
+
+	bound := d.last + 1
+	for index := range d.pending {
+		if index < bound {
+			bound = index
+		}
+	}
+	reach := d.lattice.S * d.lattice.P
+	kept := d.consumed[:0]
+	for _, index := range d.consumed {
+		if index+reach >= bound {
+			kept = append(kept, index)
+			continue
+		}
+		err := d.lattice.ReleaseChunk(index)
+		if err != nil {
+			return err
+		}
+	}
+	d.consumed = kept
+	return nil
+}
+
+// releaseAll releases the consumed chunks kept for the pending fetches
+func (d *dagWalker) releaseAll() error {
+	d.Lock()
+	defer d.Unlock()
+
+	for _, index := range d.consumed {
+		err := d.lattice.ReleaseChunk(index)
+		if err != nil {
+			return err
+		}
+	}
+	d.consumed = nil
+	return nil
+}
+
+// getNode gets the chunk of the node through the lattice and re-uploads it if it was repaired.
+// lost reports that the chunk could not be recovered
+func (d *dagWalker) getNode(cid string) (node *dag.ProtoNode, lost bool, err error) {
+	index, ok := d.metaData.DataCIDIndexMap[cid]
+	if !ok {
+		return nil, false, xerrors.Errorf("chunk with CID %s is not in the lattice: %w", cid, ErrMetadataCorrupt)
+	}
+	chunk, hasRepaired, err := d.lattice.GetChunkContext(d.ctx, index)
+	if err != nil && d.ctx.Err() != nil {
+		return nil, false, d.ctx.Err()
+	}
+	if err != nil {
+		return nil, true, xerrors.Errorf("fail to recover chunk with CID: %w", err)
+	}
+
+	// upload missing chunk back to the network if allowed.
+	// The getter has already verified the repaired chunk against its CID
+	if hasRepaired {
+		err = d.client.dataReupload(chunk, cid, d.option.UploadRecoverData)
+		if err != nil {
+			return nil, false, err
+		}
+		d.Lock()
+		d.repaired = true
+		d.Unlock()
+	}
+
+	// unmarshal
+	node, err = d.client.GetDagNodeFromRawBytes(chunk)
+	if err != nil {
+		return nil, false, xerrors.Errorf("fail to parse raw data: %s", err)
+	}
+	return node, false, nil
+}
@@ -1,11 +1,19 @@
 package cmd
 
 import (
+	"context"
+	"ipfs-alpha-entanglement-code/client"
+	"ipfs-alpha-entanglement-code/daemon"
+	"ipfs-alpha-entanglement-code/entangler"
+	"ipfs-alpha-entanglement-code/gateway"
 	"ipfs-alpha-entanglement-code/performance"
 	"ipfs-alpha-entanglement-code/util"
 	"log"
 	"math/rand"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -13,115 +21,558 @@ import (
 
 // initCmd inits cmd for user interaction
 func (c *Client) initCmd() {
+	var level, format string
 	c.Command = &cobra.Command{
 		Use: "entangler",
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			logLevel, err := util.ParseLevel(level)
+			if err != nil {
+				return err
+			}
+			logFormat, err := util.ParseFormat(format)
+			if err != nil {
+				return err
+			}
+			c.SetLogger(util.NewLogger(os.Stderr, logLevel, logFormat))
+			return nil
+		},
 	}
+	c.PersistentFlags().StringVar(&level, "log-level", "info", "Log level: debug, info, warn, error or off")
+	c.PersistentFlags().StringVar(&format, "log-format", "text", "Log format: text or json")
 
 	c.AddUploadCmd()
 	c.AddDownloadCmd()
+	c.AddListCmd()
+	c.AddInfoCmd()
+	c.AddCatalogCmd()
+	c.AddCheckCmd()
+	c.AddRepairCmd()
+	c.AddDaemonCmd()
+	c.AddGatewayCmd()
 	c.AddPerformanceCmd()
 }
 
 // AddUploadCmd enables upload functionality
 func (c *Client) AddUploadCmd() {
-	var alpha, s, p int
+	var opt client.UploadOption
+	var name string
 	uploadCmd := &cobra.Command{
 		Use:   "upload [path]",
 		Short: "Upload a file to IPFS",
-		Long:  "Upload a file to IPFS with optional entanglement",
+		Long:  "Upload a file to IPFS with optional entanglement. The file is recorded in the local catalog",
 		Args:  cobra.MinimumNArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
-			util.EnableLogPrint()
-
-			cid, metaCID, pinResult, err := c.Upload(args[0], alpha, s, p)
-			if len(cid) > 0 {
-				log.Println("Finish adding file to IPFS. File CID: ", cid)
+			result, err := c.UploadFile(context.Background(), args[0], opt)
+			if len(result.RootCID) > 0 {
+				log.Println("Finish adding file to IPFS. File CID: ", result.RootCID)
 			}
-			if len(metaCID) > 0 {
-				log.Println("Finish adding metaData to IPFS. MetaFile CID: ", metaCID)
+			if len(result.MetaCID) > 0 {
+				log.Println("Finish adding metaData to IPFS. MetaFile CID: ", result.MetaCID)
+			}
+			if len(result.RootCID) > 0 {
+				errCatalog := c.recordUpload(args[0], name, result, opt, err == nil)
+				if errCatalog != nil {
+					log.Println("Error:", errCatalog)
+				}
 			}
 			if err != nil {
 				log.Println("Error:", err)
 				os.Exit(1)
 			}
-			if pinResult != nil {
-				err = pinResult()
-				if err != nil {
-					log.Println("Error:", err)
-					os.Exit(1)
-				}
-			}
 			log.Println("Upload succeeds.")
 		},
 	}
-	uploadCmd.Flags().IntVarP(&alpha, "alpha", "a", 0, "Set entanglement alpha. 0 means no entanglement")
-	uploadCmd.Flags().IntVarP(&s, "s", "s", 0, "Set entanglement s")
-	uploadCmd.Flags().IntVarP(&p, "p", "p", 0, "Set entanglement p")
+	uploadCmd.Flags().StringVar(&name, "name", "", "Name of the file in the catalog. Default is the file name")
+	uploadCmd.Flags().IntVarP(&opt.Alpha, "alpha", "a", 0, "Set entanglement alpha. 0 means no entanglement")
+	uploadCmd.Flags().IntVarP(&opt.S, "s", "s", 0, "Set entanglement s")
+	uploadCmd.Flags().IntVarP(&opt.P, "p", "p", 0, "Set entanglement p")
+	uploadCmd.Flags().BoolVar(&opt.Resume, "resume", false,
+		"Resume a failed upload from its journal instead of starting over")
+	uploadCmd.Flags().StringVar(&opt.JournalPath, "journal", "",
+		"Provide the path of the upload journal. Default is under the entangler config directory")
+	uploadCmd.Flags().IntVar(&opt.AddWorkers, "add-workers", client.DefaultAddWorkers,
+		"Set the number of parities added to IPFS concurrently")
+	uploadCmd.Flags().IntVar(&opt.PinWorkers, "pin-workers", client.DefaultPinWorkers,
+		"Set the number of parities pinned in the cluster concurrently")
+	uploadCmd.Flags().StringVar((*string)(&opt.PinGroup), "pin-group", string(client.PinGroupNone),
+		"Group parities under one pinned DAG node per strand or per lattice window (none|strand|window)")
+	uploadCmd.Flags().IntVar(&opt.PackSize, "pack-size", 0,
+		"Pack this number of contiguous parities of a strand into one storage object. 0 means no packing")
 
 	c.AddCommand(uploadCmd)
 }
 
 // AddDownloadCmd enables download functionality
 func (c *Client) AddDownloadCmd() {
-	var opt DownloadOption
+	var opt client.DownloadOption
+	var ref client.Ref
 	var path string
+	var byteRange string
+	var hedge string
+	var strategy string
+	var plan bool
+	var cost string
+	var reportPath string
 	downloadCmd := &cobra.Command{
-		Use:   "download [cid] [path]",
+		Use:   "download [cid|name] [path]",
 		Short: "Download a file from IPFS",
-		Long:  "Download a file from IPFS. Do recovery if data is missing",
-		Args:  cobra.MinimumNArgs(1),
+		Long: "Download a file from IPFS. Do recovery if data is missing. " +
+			"A file of the catalog is found by its name. Without metafile cid, the metadata of the file " +
+			"is found in the catalog or among the cluster pins",
+		Args: cobra.MinimumNArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
-			util.EnableLogPrint()
-
-			out, err := c.Download(args[0], path, opt)
+			ref.RootCID = args[0]
+			if entry, ok := c.lookup(args[0]); ok {
+				ref.RootCID = entry.RootCID
+				if len(ref.MetaCID) == 0 {
+					ref.MetaCID = entry.MetaCID
+				}
+				if len(path) == 0 && args[0] == entry.Name {
+					path = filepath.Base(entry.Name)
+				}
+			}
+			if len(byteRange) > 0 {
+				r, err := client.ParseByteRange(byteRange)
+				if err != nil {
+					log.Println("Error:", err)
+					os.Exit(1)
+				}
+				opt.Range = r
+			}
+			hedger, err := client.ParseHedger(hedge)
 			if err != nil {
 				log.Println("Error:", err)
 				os.Exit(1)
 			}
+			opt.Hedger = hedger
+			opt.Strategy, err = entangler.ParseRecoveryStrategy(strategy)
+			if err != nil {
+				log.Println("Error:", err)
+				os.Exit(1)
+			}
+			if plan {
+				model, err := entangler.ParseCostModel(cost)
+				if err != nil {
+					log.Println("Error:", err)
+					os.Exit(1)
+				}
+				recoveryPlan, err := c.Plan(ref, opt, model)
+				if err != nil {
+					log.Println("Error:", err)
+					os.Exit(1)
+				}
+				err = PrintPlan(os.Stdout, recoveryPlan)
+				if err != nil {
+					log.Println("Error:", err)
+					os.Exit(1)
+				}
+				return
+			}
+			out, report, err := c.downloadToPath(context.Background(), ref, path, opt)
+			if len(reportPath) > 0 && report != nil {
+				errReport := client.WriteReport(reportPath, report)
+				if errReport != nil {
+					log.Println("Error:", errReport)
+				}
+			}
+			if err != nil {
+				log.Println("Error:", err)
+				os.Exit(1)
+			}
+			if len(report.Holes) > 0 {
+				log.Printf("Download is partial to '%s': %d unrecoverable ranges filled with zeros.\n",
+					out, len(report.Holes))
+				os.Exit(2)
+			}
 			log.Printf("Download succeeds to '%s'.\n", out)
 		},
 	}
 	downloadCmd.Flags().StringVarP(&path, "output", "o", "",
-		"Provide output path to store the downloaded stuff")
-	downloadCmd.Flags().StringVarP(&opt.MetaCID, "metacid", "m",
-		"", "Provide metafile cid for recovery")
+		"Provide output path to store the downloaded stuff ('-' for stdout)")
+	downloadCmd.Flags().StringVarP(&ref.MetaCID, "metacid", "m",
+		"", "Provide metafile cid for recovery. Default is found from the file cid")
 	downloadCmd.Flags().BoolVarP(&opt.UploadRecoverData, "upload-recovery",
 		"u", true, "Allow upload recovered chunk back to IPFS network")
 	downloadCmd.Flags().IntSliceVar(&opt.DataFilter, "missing-data",
 		[]int{}, "Specify the missing data blocks for testing")
+	downloadCmd.Flags().IntVar(&opt.Workers, "workers", client.DefaultDownloadWorkers,
+		"Number of blocks fetched or repaired concurrently")
+	downloadCmd.Flags().StringVar(&byteRange, "range", "",
+		"Only download the given part of the file, as offset:length (offset: reads until the end)")
+	downloadCmd.Flags().StringVar(&hedge, "hedge", "off",
+		"Repair blocks whose download is slower than a delay: off, auto (learned) or a duration")
+	downloadCmd.Flags().StringVar(&strategy, "strategy", "hybrid",
+		"Recovery strategy: hybrid, sequential, parallel or adaptive")
+	downloadCmd.Flags().IntVar(&opt.MaxRequests, "max-requests", entangler.DefaultMaxDownloads,
+		"Maximum number of concurrent IPFS requests, shared fairly between the blocks being recovered")
+	downloadCmd.Flags().BoolVar(&plan, "plan", false,
+		"Dry run: print the cheapest recovery plan of the file without downloading it (requires -m)")
+	downloadCmd.Flags().StringVar(&cost, "cost", "blocks",
+		"Cost minimized by the plan: blocks, bytes or latency")
+	downloadCmd.Flags().StringVar(&reportPath, "report", "",
+		"Write a JSON report of the download to the given path: blocks fetched and repaired, bytes and time")
+	downloadCmd.Flags().BoolVar(&opt.Partial, "partial", false,
+		"Write the unrecoverable ranges as zeros instead of failing. They are listed in the holes of the report")
 
 	c.AddCommand(downloadCmd)
 }
 
+// AddListCmd enables the listing of the catalog
+func (c *Client) AddListCmd() {
+	listCmd := &cobra.Command{
+		Use:   "ls",
+		Short: "List the uploaded files",
+		Long:  "List the files recorded in the local catalog by their upload",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			files, err := c.Catalog()
+			if err != nil {
+				log.Println("Error:", err)
+				os.Exit(1)
+			}
+			err = PrintCatalog(os.Stdout, files.List())
+			if err != nil {
+				log.Println("Error:", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	c.AddCommand(listCmd)
+}
+
+// AddInfoCmd enables the description of a file of the catalog
+func (c *Client) AddInfoCmd() {
+	var pins bool
+	infoCmd := &cobra.Command{
+		Use:   "info [name|cid]",
+		Short: "Describe an uploaded file",
+		Long:  "Describe a file of the local catalog, found by its name, its cid or its metafile cid",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			entry, ok := c.lookup(args[0])
+			if !ok {
+				log.Printf("Error: no file %s in the catalog\n", args[0])
+				os.Exit(1)
+			}
+			var report *client.PinReport
+			if pins && len(entry.MetaCID) > 0 {
+				var err error
+				report, err = c.CheckPins(context.Background(),
+					client.Ref{RootCID: entry.RootCID, MetaCID: entry.MetaCID}, 0, 0)
+				if err != nil {
+					log.Println("Error:", err)
+					os.Exit(1)
+				}
+			}
+			err := PrintEntry(os.Stdout, entry, report)
+			if err != nil {
+				log.Println("Error:", err)
+				os.Exit(1)
+			}
+		},
+	}
+	infoCmd.Flags().BoolVar(&pins, "pins", false, "Also check the pins of the file in the cluster")
+
+	c.AddCommand(infoCmd)
+}
+
+// AddCatalogCmd enables the export and the import of the catalog
+func (c *Client) AddCatalogCmd() {
+	catalogCmd := &cobra.Command{
+		Use:   "catalog",
+		Short: "Export or import the catalog of the uploaded files",
+	}
+
+	exportCmd := &cobra.Command{
+		Use:   "export [path]",
+		Short: "Export the catalog",
+		Long:  "Write the catalog as JSON to the path, or to the standard output",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			files, err := c.Catalog()
+			if err != nil {
+				log.Println("Error:", err)
+				os.Exit(1)
+			}
+			w := os.Stdout
+			if len(args) > 0 && args[0] != StdoutPath {
+				w, err = os.OpenFile(args[0], os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+				if err != nil {
+					log.Println("Error:", err)
+					os.Exit(1)
+				}
+				defer w.Close()
+			}
+			err = files.Export(w)
+			if err != nil {
+				log.Println("Error:", err)
+				os.Exit(1)
+			}
+		},
+	}
+	catalogCmd.AddCommand(exportCmd)
+
+	importCmd := &cobra.Command{
+		Use:   "import [path]",
+		Short: "Import a catalog",
+		Long:  "Add the files of an exported catalog to the local catalog",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			files, err := c.Catalog()
+			if err != nil {
+				log.Println("Error:", err)
+				os.Exit(1)
+			}
+			r, err := os.Open(args[0])
+			if err != nil {
+				log.Println("Error:", err)
+				os.Exit(1)
+			}
+			defer r.Close()
+			imported, err := files.Import(r)
+			if err != nil {
+				log.Println("Error:", err)
+				os.Exit(1)
+			}
+			log.Printf("Imported %d files.\n", imported)
+		},
+	}
+	catalogCmd.AddCommand(importCmd)
+
+	c.AddCommand(catalogCmd)
+}
+
+// AddCheckCmd enables the check of the availability of a file
+func (c *Client) AddCheckCmd() {
+	var opt client.CheckOption
+	var ref client.Ref
+	checkCmd := &cobra.Command{
+		Use:   "check [cid]",
+		Short: "Check the blocks of a file in IPFS",
+		Long:  "Check which data chunks and parities of an entangled file are missing, without downloading them",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			ref.RootCID = args[0]
+			report, err := c.Check(context.Background(), ref, opt)
+			if err != nil {
+				log.Println("Error:", err)
+				os.Exit(1)
+			}
+			err = PrintCheck(os.Stdout, report)
+			if err != nil {
+				log.Println("Error:", err)
+				os.Exit(1)
+			}
+			if !report.Recoverable() {
+				os.Exit(1)
+			}
+			if !report.Healthy() {
+				os.Exit(2)
+			}
+		},
+	}
+	checkCmd.Flags().StringVarP(&ref.MetaCID, "metacid", "m", "",
+		"Provide metafile cid of the file. Default is found from the file cid")
+	checkCmd.Flags().IntVar(&opt.Workers, "workers", client.DefaultCheckWorkers,
+		"Number of blocks probed concurrently")
+	checkCmd.Flags().IntSliceVar(&opt.DataFilter, "missing-data",
+		[]int{}, "Specify the missing data blocks for testing")
+
+	c.AddCommand(checkCmd)
+}
+
+// AddRepairCmd enables the repair of the missing blocks of a file
+func (c *Client) AddRepairCmd() {
+	var opt client.DownloadOption
+	var ref client.Ref
+	var strategy string
+	repairCmd := &cobra.Command{
+		Use:   "repair [cid]",
+		Short: "Repair the missing blocks of a file",
+		Long:  "Rebuild the missing data chunks and parities of an entangled file and add them back to IPFS",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			ref.RootCID = args[0]
+			var err error
+			opt.Strategy, err = entangler.ParseRecoveryStrategy(strategy)
+			if err != nil {
+				log.Println("Error:", err)
+				os.Exit(1)
+			}
+			report, err := c.Repair(context.Background(), ref, opt)
+			if report != nil {
+				log.Printf("Repaired %d data chunks and %d parities, %d failed.\n",
+					len(report.DataRepaired), len(report.ParitiesRepaired), len(report.Failed))
+			}
+			if err != nil {
+				log.Println("Error:", err)
+				os.Exit(1)
+			}
+		},
+	}
+	repairCmd.Flags().StringVarP(&ref.MetaCID, "metacid", "m", "",
+		"Provide metafile cid of the file. Default is found from the file cid")
+	repairCmd.Flags().IntVar(&opt.Workers, "workers", client.DefaultCheckWorkers,
+		"Number of blocks probed concurrently")
+	repairCmd.Flags().StringVar(&strategy, "strategy", "hybrid",
+		"Recovery strategy: hybrid, sequential, parallel or adaptive")
+	repairCmd.Flags().IntSliceVar(&opt.DataFilter, "missing-data",
+		[]int{}, "Specify the missing data blocks for testing")
+
+	c.AddCommand(repairCmd)
+}
+
+// AddDaemonCmd enables the HTTP API daemon
+func (c *Client) AddDaemonCmd() {
+	var opt daemon.Option
+	var strategy string
+	daemonCmd := &cobra.Command{
+		Use:   "daemon",
+		Short: "Serve the entangler over an HTTP API",
+		Long: "Run a long-lived daemon uploading, downloading, checking and repairing files as background jobs " +
+			"through an HTTP API, and repairing the registered files periodically. It stops on interrupt",
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			var err error
+			opt.Repair.Maintain.Strategy, err = entangler.ParseRecoveryStrategy(strategy)
+			if err != nil {
+				log.Println("Error:", err)
+				os.Exit(1)
+			}
+			server, err := daemon.NewDaemon(c.Client, opt)
+			if err != nil {
+				log.Println("Error:", err)
+				os.Exit(1)
+			}
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			err = server.Serve(ctx)
+			if err != nil {
+				log.Println("Error:", err)
+				os.Exit(1)
+			}
+		},
+	}
+	daemonCmd.Flags().StringVar(&opt.Addr, "addr", daemon.DefaultAddr, "Address of the HTTP API")
+	daemonCmd.Flags().StringVar(&opt.StateDir, "state-dir", "",
+		"Directory of the daemon state. Default is under the entangler config directory")
+	daemonCmd.Flags().StringVar(&opt.CatalogPath, "catalog", "",
+		"Path of the catalog of the files. Default is the catalog of the commands")
+	daemonCmd.Flags().IntVar(&opt.MaxJobs, "max-jobs", daemon.DefaultMaxJobs,
+		"Number of jobs running at the same time, the others are queued")
+	daemonCmd.Flags().DurationVar(&opt.Repair.Interval, "repair-interval", time.Hour,
+		"Time between two checks and repairs of a file of the catalog. 0 disables the background repair")
+	daemonCmd.Flags().IntVar(&opt.Repair.Workers, "repair-workers", daemon.DefaultRepairWorkers,
+		"Number of files checked and repaired at the same time")
+	daemonCmd.Flags().IntVar(&opt.Repair.Maintain.Workers, "repair-probes", client.DefaultCheckWorkers,
+		"Number of blocks and pins of a file probed or repaired concurrently")
+	daemonCmd.Flags().IntVar(&opt.Repair.Maintain.MaxMissing, "repair-max-missing", 0,
+		"Number of missing blocks of a file tolerated before repairing it")
+	daemonCmd.Flags().IntVar(&opt.Repair.Maintain.MinPinPeers, "repair-min-peers", client.DefaultMinPinPeers,
+		"Number of cluster peers a pin must be held by, it is pinned again below")
+	daemonCmd.Flags().StringVar(&strategy, "repair-strategy", "hybrid",
+		"Recovery strategy of the repairs: hybrid, sequential, parallel or adaptive")
+
+	c.AddCommand(daemonCmd)
+}
+
+// AddGatewayCmd enables the read-only HTTP gateway
+func (c *Client) AddGatewayCmd() {
+	var opt gateway.Option
+	var addr string
+	var hedge string
+	var strategy string
+	gatewayCmd := &cobra.Command{
+		Use:   "gateway",
+		Short: "Serve files read-only over HTTP",
+		Long: "Serve files at /ipfs/<cid> like an IPFS gateway, with range requests. The cid is a metadata cid, " +
+			"or a file cid given with ?metacid=<metacid>, the missing blocks are then repaired on the fly",
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			var err error
+			opt.Download.Hedger, err = client.ParseHedger(hedge)
+			if err != nil {
+				log.Println("Error:", err)
+				os.Exit(1)
+			}
+			opt.Download.Strategy, err = entangler.ParseRecoveryStrategy(strategy)
+			if err != nil {
+				log.Println("Error:", err)
+				os.Exit(1)
+			}
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			err = gateway.NewGateway(c.Client, opt).Serve(ctx, addr)
+			if err != nil {
+				log.Println("Error:", err)
+				os.Exit(1)
+			}
+		},
+	}
+	gatewayCmd.Flags().StringVar(&addr, "addr", gateway.DefaultAddr, "Address of the gateway")
+	gatewayCmd.Flags().IntVar(&opt.CacheSize, "cache", gateway.DefaultCacheSize,
+		"Number of entangled files kept open with their lattice")
+	gatewayCmd.Flags().BoolVarP(&opt.Download.UploadRecoverData, "upload-recovery",
+		"u", true, "Allow upload recovered chunk back to IPFS network")
+	gatewayCmd.Flags().IntVar(&opt.Download.Workers, "workers", client.DefaultDownloadWorkers,
+		"Number of blocks fetched or repaired concurrently by a request")
+	gatewayCmd.Flags().StringVar(&hedge, "hedge", "off",
+		"Repair blocks whose download is slower than a delay: off, auto (learned) or a duration")
+	gatewayCmd.Flags().StringVar(&strategy, "strategy", "hybrid",
+		"Recovery strategy: hybrid, sequential, parallel or adaptive")
+
+	c.AddCommand(gatewayCmd)
+}
+
 func (c *Client) AddPerformanceCmd() {
 	var rootCmd = &cobra.Command{Use: "perf"}
 
 	var fileCase string
 	var lossPercent float32
 	var iteration int
+	var strategyNames []string
 	recoverCmd := &cobra.Command{
 		Use:   "recover [testcase] [loss-percentage]",
 		Short: "Performance test for block recovery",
 		Long:  "Performance test for block recovery during download from IPFS",
 		Args:  cobra.MinimumNArgs(0),
 		Run: func(cmd *cobra.Command, args []string) {
-			util.DisableLogPrint()
-			util.DisableInfoPrint()
+			// the recovery logs of the iterations are only written on demand
+			if !cmd.Flags().Changed("log-level") {
+				c.SetLogger(util.NewLogger(os.Stderr, util.LevelOff, util.TextFormat))
+			}
+
+			strategies := make([]entangler.RecoveryStrategy, len(strategyNames))
+			for i, name := range strategyNames {
+				strategy, err := entangler.ParseRecoveryStrategy(name)
+				if err != nil {
+					log.Println("Error:", err)
+					return
+				}
+				strategies[i] = strategy
+			}
 
 			rand.Seed(time.Now().UnixNano())
-			result := performance.PerfRecovery(fileCase, lossPercent, iteration)
-			if result.Err != nil {
-				log.Println("Error:", result.Err)
-				return
+			results := performance.PerfRecoveryStrategies(fileCase, lossPercent, iteration, strategies)
+			for _, result := range results {
+				if result.Err != nil {
+					log.Println("Error:", result.Err)
+					return
+				}
+				log.Printf("Strategy: %s\n", result.Strategy)
+				log.Printf("Data Recovery Rate: %f\n", result.RecoverRate)
+				log.Printf("Parity Overhead: %f\n", result.DownloadParity)
+				log.Printf("Successfully Downloaded Block: %d\n", result.PartialSuccessCnt)
+				log.Printf("Average Duration: %s\n", result.Duration)
 			}
-			log.Printf("Data Recovery Rate: %f\n", result.RecoverRate)
-			log.Printf("Parity Overhead: %f\n", result.DownloadParity)
-			log.Printf("Successfully Downloaded Block: %d\n", result.PartialSuccessCnt)
 		},
 	}
 	recoverCmd.Flags().StringVarP(&fileCase, "testcase", "t", "25MB", "Test cases of different file sizes")
 	recoverCmd.Flags().Float32VarP(&lossPercent, "loss-percent", "p", 0.5, "Loss percentage of the parities")
 	recoverCmd.Flags().IntVarP(&iteration, "iteration", "i", 5, "Repeat the performance test for several times")
+	recoverCmd.Flags().StringSliceVar(&strategyNames, "strategy", []string{"hybrid"},
+		"Recovery strategies compared on the same loss patterns: hybrid, sequential, parallel, adaptive")
 	rootCmd.AddCommand(recoverCmd)
 
 	var repFactor int
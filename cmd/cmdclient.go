@@ -1,100 +1,104 @@
 package cmd
 
 import (
-	"encoding/json"
-	ipfscluster "ipfs-alpha-entanglement-code/ipfs-cluster"
-	ipfsconnector "ipfs-alpha-entanglement-code/ipfs-connector"
+	"ipfs-alpha-entanglement-code/catalog"
+	"ipfs-alpha-entanglement-code/client"
+	"ipfs-alpha-entanglement-code/util"
+	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/spf13/cobra"
 	"golang.org/x/xerrors"
 )
 
-type Metadata struct {
-	Alpha int
-	S     int
-	P     int
-
-	RootCID string
-
-	DataCIDIndexMap map[string]int
-	ParityCIDs      [][]string
-}
-
+// Client is the command line interface on top of the client SDK
 type Client struct {
-	*ipfsconnector.IPFSConnector
-	IPFSClusterConnector *ipfscluster.Connector
+	*client.Client
 	*cobra.Command
-}
-
-// NewClient creates a new client for futhur use
-func NewClient() (client *Client, err error) {
-	client = &Client{}
-	client.initCmd()
 
-	return client, nil
+	catalog *catalog.Catalog
 }
 
-// init ipfs connector for future usage
-func (c *Client) InitIPFSConnector() error {
-	conn, err := ipfsconnector.CreateIPFSConnector(0)
-	if err != nil {
-		return xerrors.Errorf("fail to connect to IPFS: %s", err)
+// NewClient creates a new client for futhur use
+func NewClient() (c *Client, err error) {
+	c = &Client{}
+	// the metadata of a file of the catalog is known without asking the cluster
+	resolve := func(rootCID string) (string, bool) {
+		entry, ok := c.lookup(rootCID)
+		return entry.MetaCID, ok && entry.RootCID == rootCID
 	}
-	c.IPFSConnector = conn
-
-	return nil
-}
-
-// init ipfs cluster connector for future usage
-func (c *Client) InitIPFSClusterConnector() error {
-	conn, err := ipfscluster.CreateIPFSClusterConnector(0)
+	c.Client, err = client.NewClient(client.ClientOption{Resolve: resolve})
 	if err != nil {
-		return xerrors.Errorf("fail to connect to IPFS Cluster: %s", err)
+		return nil, err
 	}
-	c.IPFSClusterConnector = conn
+	c.initCmd()
 
-	return nil
+	return c, nil
 }
 
-// AddAndPinAsFile adds a file to IPFS network and pin the file in cluster with a replication factor
-// replicate = 0 means use default config in the cluster
-func (c *Client) AddAndPinAsFile(data []byte, replicate int) (cid string, err error) {
-	// upload file to IPFS network
-	cid, err = c.AddFileFromMem(data)
+// Catalog opens the catalog of the uploaded files on first use
+func (c *Client) Catalog() (*catalog.Catalog, error) {
+	if c.catalog != nil {
+		return c.catalog, nil
+	}
+	files, err := catalog.Open("")
 	if err != nil {
-		return "", err
+		return nil, err
 	}
+	c.catalog = files
+	return files, nil
+}
 
-	// pin file in cluster
-	err = c.IPFSClusterConnector.AddPin(cid, replicate)
-	return cid, err
+// SetLogger sets the logger of the client. It also becomes the default logger,
+// used by the lattices and the entanglers created by the performance tests
+func (c *Client) SetLogger(logger *util.Logger) {
+	c.Client.SetLogger(logger)
+	util.SetDefault(logger)
 }
 
-// AddAndPinAsRaw adds raw data to IPFS network and pin it in cluster with a replication factor
-// replicate = 0 means use default config in the cluster
-func (c *Client) AddAndPinAsRaw(data []byte, replicate int) (cid string, err error) {
-	// upload raw bytes to IPFS network
-	cid, err = c.AddRawData(data)
+// lookup finds a file of the catalog by its name, cid or metafile cid. A catalog that cannot be read
+// has no file
+func (c *Client) lookup(key string) (catalog.Entry, bool) {
+	files, err := c.Catalog()
 	if err != nil {
-		return "", err
+		c.Logger.Warn("Fail to open the catalog", "err", err)
+		return catalog.Entry{}, false
 	}
-
-	// pin data in cluster
-	err = c.IPFSClusterConnector.AddPin(cid, replicate)
-	return cid, err
+	return files.Lookup(key)
 }
 
-// GetMetaData downloads metafile from IPFS network and returns a metafile object
-func (c *Client) GetMetaData(cid string) (metadata *Metadata, err error) {
-	data, err := c.GetFileToMem(cid)
+// recordUpload records the uploaded file in the catalog. An upload that failed is incomplete
+func (c *Client) recordUpload(path string, name string, result client.UploadResult, option client.UploadOption,
+	succeeded bool) error {
+
+	files, err := c.Catalog()
 	if err != nil {
-		return nil, err
+		return err
 	}
-	var myMetadata Metadata
-	err = json.Unmarshal(data, &myMetadata)
+	info, err := os.Stat(path)
 	if err != nil {
-		return nil, err
+		return xerrors.Errorf("fail to read the size of the file: %s", err)
 	}
-
-	return &myMetadata, nil
+	entry := catalog.Entry{
+		Name:      name,
+		Size:      info.Size(),
+		RootCID:   result.RootCID,
+		MetaCID:   result.MetaCID,
+		Added:     time.Now(),
+		PinStatus: catalog.PinIncomplete,
+	}
+	if len(entry.Name) == 0 {
+		entry.Name = filepath.Base(path)
+	}
+	if option.Alpha > 0 {
+		entry.Alpha, entry.S, entry.P = option.Alpha, option.S, option.P
+	}
+	if succeeded {
+		entry.PinStatus = catalog.PinPinned
+		if option.Alpha < 1 {
+			entry.PinStatus = catalog.PinNone
+		}
+	}
+	return files.Add(entry)
 }
@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"ipfs-alpha-entanglement-code/catalog"
+	"ipfs-alpha-entanglement-code/client"
+	"ipfs-alpha-entanglement-code/entangler"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// StdoutPath is the output path streaming the downloaded file to the standard output
+const StdoutPath = "-"
+
+// downloadToPath downloads the file to the given path, to the standard output if the path is StdoutPath,
+// or to a file named after the root CID if no path is given. No partial file is left behind on failure
+func (c *Client) downloadToPath(ctx context.Context, ref client.Ref, path string,
+	option client.DownloadOption) (out string, report *client.DownloadReport, err error) {
+
+	out = path
+	if len(out) == 0 {
+		out = ref.RootCID
+	}
+	if out == StdoutPath {
+		report, err = c.Download(ctx, ref, os.Stdout, option)
+		if report != nil {
+			report.Output = out
+		}
+		return out, report, err
+	}
+
+	file, err := os.OpenFile(out, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return "", nil, xerrors.Errorf("fail to create output file: %s", err)
+	}
+	report, err = c.Download(ctx, ref, file, option)
+	errClose := file.Close()
+	if err == nil {
+		err = errClose
+	}
+	if err != nil {
+		os.Remove(out)
+		return "", report, err
+	}
+	report.Output = out
+
+	return out, report, nil
+}
+
+// PrintPlan writes the plan in a readable form
+func PrintPlan(w io.Writer, plan *entangler.RecoveryPlan) error {
+	var err error
+	printf := func(format string, args ...interface{}) {
+		if err == nil {
+			_, err = fmt.Fprintf(w, format, args...)
+		}
+	}
+
+	printf("Recovery plan (cost model: %s)\n", plan.Model)
+	for _, fetch := range plan.Fetches {
+		printf("  fetch  %s\n", fetch.Block)
+	}
+	for _, repair := range plan.Repairs {
+		printf("  repair %s from %s and %s\n", repair.Target, repair.Left, repair.Right)
+	}
+	for _, index := range plan.Unrecoverable {
+		printf("  lost   data %d\n", index)
+	}
+	printf("%d fetches (about %d bytes), %d repairs, %d unrecoverable chunks, cost %g\n",
+		len(plan.Fetches), plan.Bytes, len(plan.Repairs), len(plan.Unrecoverable), plan.Cost)
+
+	return err
+}
+
+// PrintCheck writes the check report in a readable form
+func PrintCheck(w io.Writer, report *client.CheckReport) error {
+	var err error
+	printf := func(format string, args ...interface{}) {
+		if err == nil {
+			_, err = fmt.Fprintf(w, format, args...)
+		}
+	}
+
+	printf("File %s (metadata %s): %d chunks\n", report.RootCID, report.MetaCID, report.Chunks)
+	for _, index := range report.MissingData {
+		printf("  missing data %d\n", index)
+	}
+	for _, parity := range report.MissingParities {
+		printf("  missing %s\n", parity)
+	}
+	for _, index := range report.Unrecoverable {
+		printf("  lost    data %d\n", index)
+	}
+	printf("%d missing chunks, %d missing parities, %d unrecoverable chunks\n",
+		len(report.MissingData), len(report.MissingParities), len(report.Unrecoverable))
+
+	return err
+}
+
+// PrintCatalog writes the entries of the catalog as a table
+func PrintCatalog(w io.Writer, entries []catalog.Entry) error {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "NAME\tSIZE\tROOT CID\tMETA CID\tALPHA/S/P\tADDED\tPIN")
+	for _, entry := range entries {
+		metaCID, parameters := entry.MetaCID, fmt.Sprintf("%d/%d/%d", entry.Alpha, entry.S, entry.P)
+		if len(metaCID) == 0 {
+			metaCID, parameters = "-", "-"
+		}
+		pinStatus := string(entry.PinStatus)
+		if len(pinStatus) == 0 {
+			pinStatus = "-"
+		}
+		fmt.Fprintf(table, "%s\t%d\t%s\t%s\t%s\t%s\t%s\n", entry.Name, entry.Size, entry.RootCID, metaCID,
+			parameters, entry.Added.Local().Format("2006-01-02 15:04"), pinStatus)
+	}
+	return table.Flush()
+}
+
+// PrintEntry writes an entry of the catalog, with the cluster pins of the file if given
+func PrintEntry(w io.Writer, entry catalog.Entry, pins *client.PinReport) error {
+	var err error
+	printf := func(format string, args ...interface{}) {
+		if err == nil {
+			_, err = fmt.Fprintf(w, format, args...)
+		}
+	}
+
+	printf("Name:       %s\n", entry.Name)
+	printf("Size:       %d bytes\n", entry.Size)
+	printf("Root CID:   %s\n", entry.RootCID)
+	if len(entry.MetaCID) > 0 {
+		printf("Meta CID:   %s\n", entry.MetaCID)
+		printf("Alpha/S/P:  %d/%d/%d\n", entry.Alpha, entry.S, entry.P)
+	}
+	printf("Added:      %s\n", entry.Added.Local().Format(time.RFC3339))
+	if len(entry.PinStatus) > 0 {
+		printf("Pin status: %s\n", entry.PinStatus)
+	}
+	if pins != nil {
+		printf("Cluster:    %d pins, %d degraded\n", len(pins.Peers), len(pins.Degraded))
+		for _, cid := range pins.Degraded {
+			printf("  degraded %s (%d peers)\n", cid, pins.Peers[cid])
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,475 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"ipfs-alpha-entanglement-code/catalog"
+	"ipfs-alpha-entanglement-code/client"
+	"ipfs-alpha-entanglement-code/entangler"
+	"ipfs-alpha-entanglement-code/gateway"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// APIPrefix is the path prefix of every endpoint of the API
+const APIPrefix = "/api/v0/"
+
+// Health is the state of the daemon returned by the health endpoint
+type Health struct {
+	Uptime time.Duration
+	// whether the IPFS node answers
+	IPFS bool
+	// number of jobs in each state
+	Jobs map[JobState]int
+}
+
+// apiError is the body of a failed request
+type apiError struct {
+	Error string
+}
+
+// Handler returns the handler serving the API:
+//
+//	POST   upload?name&alpha&s&p&pack-size&pin-group  upload the request body
+//	POST   download?cid&metacid&range&partial&strategy  download and recover a file into the daemon
+//	POST   check?cid&metacid                          check the blocks of a file
+//	POST   repair?cid&metacid&strategy                repair the missing blocks of a file
+//	GET    jobs                                       list the jobs
+//	GET    jobs/{id}                                  get the status, progress and result of a job
+//	DELETE jobs/{id}                                  cancel a job, or forget a finished job and its output
+//	GET    jobs/{id}/output                           get the file downloaded by a job
+//	GET    files                                      list the files of the catalog
+//	POST   files?cid&metacid&name                     register an entangled file for the background repair
+//	DELETE files?cid                                  forget a file
+//	GET    files/health                               get the health of the files found by the background repair
+//	POST   maintain?cid                               check, repair and pin again a registered file now
+//	GET    health                                     get the state of the daemon and of IPFS
+//
+// The operations run as jobs: they return 202 with the status of the job.
+// The files are also served under /ipfs/<cid> by the gateway, the files of the catalog
+// are recovered by their file CID
+func (d *Daemon) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(APIPrefix+"upload", d.handleUpload)
+	mux.HandleFunc(APIPrefix+"download", d.handleDownload)
+	mux.HandleFunc(APIPrefix+"check", d.handleCheck)
+	mux.HandleFunc(APIPrefix+"repair", d.handleRepair)
+	mux.HandleFunc(APIPrefix+"jobs", d.handleJobs)
+	mux.HandleFunc(APIPrefix+"jobs/", d.handleJob)
+	mux.HandleFunc(APIPrefix+"files", d.handleFiles)
+	mux.HandleFunc(APIPrefix+"files/health", d.handleFilesHealth)
+	mux.HandleFunc(APIPrefix+"maintain", d.handleMaintain)
+	mux.HandleFunc(APIPrefix+"health", d.handleHealth)
+	mux.Handle(gateway.PathPrefix, d.gateway)
+	return mux
+}
+
+// handleUpload spools the body to the state directory, then uploads it in a job
+func (d *Daemon) handleUpload(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	query := r.URL.Query()
+	var option client.UploadOption
+	var err error
+	for name, value := range map[string]*int{"alpha": &option.Alpha, "s": &option.S, "p": &option.P,
+		"pack-size": &option.PackSize} {
+		*value, err = queryInt(query.Get(name), 0)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, xerrors.Errorf("invalid %s: %s", name, err))
+			return
+		}
+	}
+	option.PinGroup = client.PinGroupMode(query.Get("pin-group"))
+	if option.Alpha > 0 {
+		err = entangler.ValidateParameters(option.Alpha, option.S, option.P)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	spool, err := os.CreateTemp(filepath.Join(d.option.StateDir, uploadDir), "upload-")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, xerrors.Errorf("fail to spool the upload: %s", err))
+		return
+	}
+	size, err := io.Copy(spool, r.Body)
+	errClose := spool.Close()
+	if err == nil {
+		err = errClose
+	}
+	if err != nil {
+		os.Remove(spool.Name())
+		writeError(w, http.StatusBadRequest, xerrors.Errorf("fail to receive the file: %s", err))
+		return
+	}
+
+	name := query.Get("name")
+	job := d.jobs.Submit("upload", func(ctx context.Context, job *Job) (interface{}, error) {
+		file, err := os.Open(spool.Name())
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+
+		option.Progress = job.Report
+		result, err := d.client.Upload(ctx, file, option)
+		if err != nil {
+			return result, err
+		}
+		entry := catalog.Entry{
+			Name:      name,
+			Size:      size,
+			RootCID:   result.RootCID,
+			MetaCID:   result.MetaCID,
+			Alpha:     option.Alpha,
+			S:         option.S,
+			P:         option.P,
+			Added:     time.Now(),
+			PinStatus: catalog.PinPinned,
+		}
+		if len(entry.MetaCID) == 0 {
+			entry.PinStatus = catalog.PinNone
+		}
+		if len(entry.Name) == 0 {
+			entry.Name = entry.RootCID
+		}
+		return result, d.files.Add(entry)
+	}, func() { os.Remove(spool.Name()) })
+	writeJob(w, job)
+}
+
+// handleDownload downloads the file into the state directory in a job. It is then served as the job output
+func (d *Daemon) handleDownload(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	ref, ok := d.queryRef(w, r)
+	if !ok {
+		return
+	}
+	query := r.URL.Query()
+	option := client.DownloadOption{UploadRecoverData: true, Partial: query.Get("partial") == "true"}
+	var err error
+	if value := query.Get("range"); len(value) > 0 {
+		option.Range, err = client.ParseByteRange(value)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	option.Strategy, err = queryStrategy(query.Get("strategy"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	job := d.jobs.Submit("download", func(ctx context.Context, job *Job) (interface{}, error) {
+		out := d.outputPath(job.ID())
+		file, err := os.OpenFile(out, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+		if err != nil {
+			return nil, xerrors.Errorf("fail to create output file: %s", err)
+		}
+		option.Progress = job.Report
+		report, err := d.client.Download(ctx, ref, file, option)
+		errClose := file.Close()
+		if err == nil {
+			err = errClose
+		}
+		if err != nil {
+			os.Remove(out)
+		}
+		return report, err
+	}, nil)
+	writeJob(w, job)
+}
+
+// handleCheck checks the file in a job
+func (d *Daemon) handleCheck(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	ref, ok := d.queryRef(w, r)
+	if !ok {
+		return
+	}
+	job := d.jobs.Submit("check", func(ctx context.Context, job *Job) (interface{}, error) {
+		job.Report("Checking", 0, 0)
+		return d.client.Check(ctx, ref, client.CheckOption{})
+	}, nil)
+	writeJob(w, job)
+}
+
+// handleRepair repairs the file in a job
+func (d *Daemon) handleRepair(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	ref, ok := d.queryRef(w, r)
+	if !ok {
+		return
+	}
+	strategy, err := queryStrategy(r.URL.Query().Get("strategy"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	job := d.jobs.Submit("repair", func(ctx context.Context, job *Job) (interface{}, error) {
+		job.Report("Repairing", 0, 0)
+		return d.client.Repair(ctx, ref, client.DownloadOption{Strategy: strategy})
+	}, nil)
+	writeJob(w, job)
+}
+
+// handleJobs lists the jobs
+func (d *Daemon) handleJobs(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	writeJSON(w, http.StatusOK, d.jobs.List())
+}
+
+// handleJob gets, cancels or removes a job, or serves its output
+func (d *Daemon) handleJob(w http.ResponseWriter, r *http.Request) {
+	id, output := strings.TrimPrefix(r.URL.Path, APIPrefix+"jobs/"), false
+	if strings.HasSuffix(id, "/output") {
+		id, output = strings.TrimSuffix(id, "/output"), true
+	}
+	job, ok := d.jobs.Get(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, xerrors.Errorf("no job %s", id))
+		return
+	}
+
+	if output {
+		if !allowMethod(w, r, http.MethodGet, http.MethodHead) {
+			return
+		}
+		d.serveOutput(w, r, job)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, job.Status())
+	case http.MethodDelete:
+		if !job.Status().State.Finished() {
+			d.jobs.Cancel(id)
+			writeJSON(w, http.StatusAccepted, job.Status())
+			return
+		}
+		if d.jobs.Remove(id) {
+			os.Remove(d.outputPath(id))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		allowMethod(w, r, http.MethodGet, http.MethodDelete)
+	}
+}
+
+// serveOutput serves the file downloaded by a successful download job, with range requests
+func (d *Daemon) serveOutput(w http.ResponseWriter, r *http.Request, job *Job) {
+	status := job.Status()
+	if status.Kind != "download" {
+		writeError(w, http.StatusNotFound, xerrors.Errorf("job %s has no output", status.ID))
+		return
+	}
+	if status.State != JobSucceeded {
+		writeError(w, http.StatusConflict, xerrors.Errorf("job %s is %s", status.ID, status.State))
+		return
+	}
+	file, err := os.Open(d.outputPath(status.ID))
+	if err != nil {
+		writeError(w, http.StatusNotFound, xerrors.Errorf("fail to open the output of job %s: %s", status.ID, err))
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	http.ServeContent(w, r, "", *status.Finished, file)
+}
+
+// handleFiles lists, registers or forgets the files of the catalog
+func (d *Daemon) handleFiles(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet, http.MethodPost, http.MethodDelete) {
+		return
+	}
+	query := r.URL.Query()
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, d.files.List())
+	case http.MethodPost:
+		entry, err := d.register(query.Get("cid"), query.Get("metacid"), query.Get("name"))
+		if err != nil {
+			writeError(w, http.StatusBadGateway, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, entry)
+	case http.MethodDelete:
+		removed, err := d.files.Remove(query.Get("cid"))
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if !removed {
+			writeError(w, http.StatusNotFound, xerrors.Errorf("no file %s", query.Get("cid")))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// register adds an entangled file to the catalog, with the parameters read from its metadata
+func (d *Daemon) register(rootCID string, metaCID string, name string) (catalog.Entry, error) {
+	if len(metaCID) == 0 {
+		return catalog.Entry{}, xerrors.Errorf("no metacid provided: %w", client.ErrInvalidParameters)
+	}
+	err := d.client.InitIPFSConnector()
+	if err != nil {
+		return catalog.Entry{}, err
+	}
+	metaData, err := d.client.GetMetaData(metaCID)
+	if err != nil {
+		return catalog.Entry{}, xerrors.Errorf("fail to download metaData: %w", err)
+	}
+	if len(rootCID) > 0 && rootCID != metaData.RootCID {
+		return catalog.Entry{}, xerrors.Errorf("metadata %s describes file %s, not %s: %w",
+			metaCID, metaData.RootCID, rootCID, client.ErrInvalidParameters)
+	}
+	entry := catalog.Entry{
+		Name:    name,
+		RootCID: metaData.RootCID,
+		MetaCID: metaCID,
+		Alpha:   metaData.Alpha,
+		S:       metaData.S,
+		P:       metaData.P,
+		Added:   time.Now(),
+	}
+	if len(entry.Name) == 0 {
+		entry.Name = entry.RootCID
+	}
+	return entry, d.files.Add(entry)
+}
+
+// handleFilesHealth lists the health of the files found by the background repair
+func (d *Daemon) handleFilesHealth(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	writeJSON(w, http.StatusOK, d.repair.Health())
+}
+
+// handleMaintain maintains a registered file in a job, without waiting for the background repair
+func (d *Daemon) handleMaintain(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	cid := r.URL.Query().Get("cid")
+	entry, ok := d.files.Get(cid)
+	if !ok || len(entry.MetaCID) == 0 {
+		writeError(w, http.StatusNotFound, xerrors.Errorf("no entangled file %s in the catalog", cid))
+		return
+	}
+	job := d.jobs.Submit("maintain", func(ctx context.Context, job *Job) (interface{}, error) {
+		job.Report("Maintaining", 0, 0)
+		health := d.repair.Maintain(ctx, entry)
+		if len(health.Error) > 0 {
+			return health, xerrors.New(health.Error)
+		}
+		return health, nil
+	}, nil)
+	writeJob(w, job)
+}
+
+// handleHealth reports the state of the daemon and whether IPFS is reachable
+func (d *Daemon) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	health := Health{Uptime: time.Since(d.started), Jobs: make(map[JobState]int)}
+	if d.client.InitIPFSConnector() == nil {
+		health.IPFS = d.client.IsUp()
+	}
+	for _, status := range d.jobs.List() {
+		health.Jobs[status.State]++
+	}
+	code := http.StatusOK
+	if !health.IPFS {
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, health)
+}
+
+// queryRef reads the reference of the file from the query. The metadata CID of a file of the catalog
+// is found there when it is not given
+func (d *Daemon) queryRef(w http.ResponseWriter, r *http.Request) (ref client.Ref, ok bool) {
+	query := r.URL.Query()
+	ref = client.Ref{RootCID: query.Get("cid"), MetaCID: query.Get("metacid")}
+	if len(ref.RootCID) == 0 && len(ref.MetaCID) == 0 {
+		writeError(w, http.StatusBadRequest, xerrors.Errorf("no cid or metacid provided"))
+		return ref, false
+	}
+	if len(ref.MetaCID) == 0 {
+		if record, found := d.files.Get(ref.RootCID); found {
+			ref.MetaCID = record.MetaCID
+		}
+	}
+	return ref, true
+}
+
+// queryStrategy parses the recovery strategy, hybrid by default
+func queryStrategy(value string) (entangler.RecoveryStrategy, error) {
+	if len(value) == 0 {
+		value = "hybrid"
+	}
+	return entangler.ParseRecoveryStrategy(value)
+}
+
+// queryInt parses an integer parameter, the default if it is empty
+func queryInt(value string, def int) (int, error) {
+	if len(value) == 0 {
+		return def, nil
+	}
+	return strconv.Atoi(value)
+}
+
+// allowMethod replies 405 unless the request has one of the methods
+func allowMethod(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, method := range methods {
+		if r.Method == method {
+			return true
+		}
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeError(w, http.StatusMethodNotAllowed, xerrors.Errorf("method %s not allowed", r.Method))
+	return false
+}
+
+// writeJob replies 202 with the status of the submitted job
+func writeJob(w http.ResponseWriter, job *Job) {
+	w.Header().Set("Location", APIPrefix+"jobs/"+job.ID())
+	writeJSON(w, http.StatusAccepted, job.Status())
+}
+
+// writeError replies the error as JSON. Invalid parameters are always a bad request
+func writeError(w http.ResponseWriter, code int, err error) {
+	if errors.Is(err, client.ErrInvalidParameters) {
+		code = http.StatusBadRequest
+	}
+	writeJSON(w, code, apiError{Error: err.Error()})
+}
+
+// writeJSON replies the value as JSON
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,221 @@
+package daemon
+
+import (
+	"context"
+	"ipfs-alpha-entanglement-code/catalog"
+	"ipfs-alpha-entanglement-code/client"
+	"ipfs-alpha-entanglement-code/util"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// DefaultRepairWorkers is the number of files maintained at the same time when none is given
+var DefaultRepairWorkers = 2
+
+// MaxScanPeriod bounds the time between two scans of the catalog for files due for maintenance
+var MaxScanPeriod = time.Minute
+
+// RepairOption configures the background repair of the entangled files of the catalog
+type RepairOption struct {
+	// time between two maintenances of a file. 0 disables the background repair
+	Interval time.Duration
+
+	// number of files maintained at the same time. 0 uses DefaultRepairWorkers
+	Workers int
+
+	// thresholds and concurrency of the maintenance of each file
+	Maintain client.MaintainOption
+}
+
+// FileHealth is the state of an entangled file kept by the background repair
+type FileHealth struct {
+	RootCID string
+	MetaCID string
+
+	LastCheck  time.Time
+	LastRepair time.Time
+
+	// found by the last maintenance
+	MissingData     int
+	MissingParities int
+	Unrecoverable   int
+	DegradedPins    int
+
+	// totals over every maintenance
+	Repaired int
+	Repinned int
+
+	// error of the last maintenance
+	Error string `json:",omitempty"`
+}
+
+// AutoRepair periodically maintains the entangled files of the catalog: it checks their cluster pins and
+// blocks, repairs them and pins them again. The health of the files is persisted in a JSON store
+type AutoRepair struct {
+	*sync.Mutex
+
+	client *client.Client
+	files  *catalog.Catalog
+	option RepairOption
+	logger *util.Logger
+
+	path   string
+	health map[string]FileHealth
+}
+
+// NewAutoRepair creates the background repair of the files of the catalog, with its state stored at the path
+func NewAutoRepair(c *client.Client, files *catalog.Catalog, path string, option RepairOption) (*AutoRepair, error) {
+	if option.Workers <= 0 {
+		option.Workers = DefaultRepairWorkers
+	}
+	repair := &AutoRepair{
+		Mutex:  &sync.Mutex{},
+		client: c,
+		files:  files,
+		option: option,
+		logger: c.Logger,
+		path:   path,
+		health: make(map[string]FileHealth),
+	}
+	var health []FileHealth
+	err := util.LoadJSON(path, &health)
+	if err != nil {
+		return nil, xerrors.Errorf("fail to load the repair state: %s", err)
+	}
+	for _, fileHealth := range health {
+		repair.health[fileHealth.RootCID] = fileHealth
+	}
+	return repair, nil
+}
+
+// Health returns the health of every file maintained so far
+func (a *AutoRepair) Health() []FileHealth {
+	a.Lock()
+	defer a.Unlock()
+	return a.list()
+}
+
+func (a *AutoRepair) list() []FileHealth {
+	health := make([]FileHealth, 0, len(a.health))
+	for _, fileHealth := range a.health {
+		health = append(health, fileHealth)
+	}
+	sort.Slice(health, func(i, j int) bool {
+		return health[i].RootCID < health[j].RootCID
+	})
+	return health
+}
+
+// Run maintains the files once their interval has elapsed since their last maintenance, until the context
+// is done. It returns immediately if the background repair is disabled
+func (a *AutoRepair) Run(ctx context.Context) {
+	if a.option.Interval <= 0 {
+		return
+	}
+	period := a.option.Interval
+	if period > MaxScanPeriod {
+		period = MaxScanPeriod
+	}
+	a.logger.Info("Background repair started", "interval", a.option.Interval, "workers", a.option.Workers)
+
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for {
+		a.RunOnce(ctx, false)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce maintains the entangled files of the catalog due for maintenance, or all of them if forced,
+// with a pool of workers
+func (a *AutoRepair) RunOnce(ctx context.Context, force bool) {
+	due := make([]catalog.Entry, 0)
+	now := time.Now()
+	a.Lock()
+	for _, entry := range a.files.List() {
+		if len(entry.MetaCID) == 0 {
+			continue
+		}
+		if force || now.Sub(a.health[entry.RootCID].LastCheck) >= a.option.Interval {
+			due = append(due, entry)
+		}
+	}
+	a.Unlock()
+
+	entryChan := make(chan catalog.Entry, a.option.Workers)
+	var waitGroup sync.WaitGroup
+	for w := 0; w < a.option.Workers; w++ {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			for entry := range entryChan {
+				a.Maintain(ctx, entry)
+			}
+		}()
+	}
+	for _, entry := range due {
+		if ctx.Err() != nil {
+			break
+		}
+		entryChan <- entry
+	}
+	close(entryChan)
+	waitGroup.Wait()
+}
+
+// Maintain maintains one file and records its health
+func (a *AutoRepair) Maintain(ctx context.Context, entry catalog.Entry) FileHealth {
+	ref := client.Ref{RootCID: entry.RootCID, MetaCID: entry.MetaCID}
+	report, err := a.client.Maintain(ctx, ref, a.option.Maintain)
+	if ctx.Err() != nil {
+		// an interrupted maintenance says nothing about the file
+		return a.get(entry.RootCID)
+	}
+
+	a.Lock()
+	defer a.Unlock()
+	health := a.health[entry.RootCID]
+	health.RootCID, health.MetaCID = entry.RootCID, entry.MetaCID
+	health.LastCheck = time.Now()
+	health.Error = ""
+	if err != nil {
+		health.Error = err.Error()
+		a.logger.Warn("Fail to maintain file", "cid", entry.RootCID, "err", err)
+	}
+	if report != nil {
+		if report.Pins != nil {
+			health.DegradedPins = len(report.Pins.Degraded)
+		}
+		if report.Check != nil {
+			health.MissingData = len(report.Check.MissingData)
+			health.MissingParities = len(report.Check.MissingParities)
+			health.Unrecoverable = len(report.Check.Unrecoverable)
+		}
+		if report.Repair != nil {
+			health.LastRepair = health.LastCheck
+			health.Repaired += len(report.Repair.DataRepaired) + len(report.Repair.ParitiesRepaired)
+		}
+		health.Repinned += len(report.Repinned)
+	}
+	a.health[entry.RootCID] = health
+
+	err = util.SaveJSON(a.path, a.list())
+	if err != nil {
+		a.logger.Warn("Fail to write the repair state", "err", err)
+	}
+	return health
+}
+
+// get returns the recorded health of the file
+func (a *AutoRepair) get(rootCID string) FileHealth {
+	a.Lock()
+	defer a.Unlock()
+	return a.health[rootCID]
+}
@@ -0,0 +1,159 @@
+package daemon
+
+import (
+	"context"
+	"ipfs-alpha-entanglement-code/catalog"
+	"ipfs-alpha-entanglement-code/client"
+	"ipfs-alpha-entanglement-code/gateway"
+	"ipfs-alpha-entanglement-code/util"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// DefaultAddr is the address of the HTTP API when none is given
+var DefaultAddr = "127.0.0.1:7070"
+
+// DefaultMaxJobs is the number of jobs running at the same time when none is given
+var DefaultMaxJobs = 2
+
+// Option configures the daemon
+type Option struct {
+	// address of the HTTP API. Empty uses DefaultAddr
+	Addr string
+
+	// directory keeping the health of the files, the uploads being spooled and the downloaded files.
+	// Empty uses the "daemon" directory under the entangler config directory
+	StateDir string
+
+	// catalog of the files, shared with the commands. Empty uses the default catalog
+	CatalogPath string
+
+	// number of jobs running at the same time, the others are queued
+	MaxJobs int
+
+	// background repair of the entangled files of the catalog
+	Repair RepairOption
+}
+
+// Daemon serves the client over an HTTP API. Uploads, downloads, checks and repairs run as background
+// jobs sharing one client, so the connections to IPFS and the metadata downloaded are reused.
+// It also serves the files read-only as a gateway
+type Daemon struct {
+	client *client.Client
+	option Option
+	logger *util.Logger
+
+	jobs    *Jobs
+	files   *catalog.Catalog
+	repair  *AutoRepair
+	gateway *gateway.Gateway
+	started time.Time
+}
+
+// NewDaemon creates the daemon and its state directory. The uploads and downloads left by a previous
+// run are removed, since their jobs are lost
+func NewDaemon(c *client.Client, option Option) (*Daemon, error) {
+	if len(option.Addr) == 0 {
+		option.Addr = DefaultAddr
+	}
+	if len(option.StateDir) == 0 {
+		dir, err := util.ConfigDir()
+		if err != nil {
+			return nil, xerrors.Errorf("fail to locate the daemon state: %s", err)
+		}
+		option.StateDir = filepath.Join(dir, "daemon")
+	}
+	for _, dir := range []string{uploadDir, downloadDir} {
+		path := filepath.Join(option.StateDir, dir)
+		err := os.RemoveAll(path)
+		if err == nil {
+			err = os.MkdirAll(path, 0700)
+		}
+		if err != nil {
+			return nil, xerrors.Errorf("fail to create the daemon state: %s", err)
+		}
+	}
+
+	files, err := catalog.Open(option.CatalogPath)
+	if err != nil {
+		return nil, err
+	}
+	repair, err := NewAutoRepair(c, files, filepath.Join(option.StateDir, healthFile), option.Repair)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Daemon{
+		client:  c,
+		option:  option,
+		logger:  c.Logger,
+		jobs:    NewJobs(option.MaxJobs),
+		files:   files,
+		repair:  repair,
+		started: time.Now(),
+	}
+	d.gateway = gateway.NewGateway(c, gateway.Option{
+		Resolve: d.resolve,
+		Download: client.DownloadOption{
+			UploadRecoverData: true,
+		},
+	})
+	return d, nil
+}
+
+// names of the state under the state directory
+const (
+	uploadDir   = "uploads"
+	downloadDir = "downloads"
+	healthFile  = "health.json"
+)
+
+// Jobs returns the job manager of the daemon
+func (d *Daemon) Jobs() *Jobs {
+	return d.jobs
+}
+
+// Files returns the catalog of the files
+func (d *Daemon) Files() *catalog.Catalog {
+	return d.files
+}
+
+// AutoRepair returns the background repair of the files of the catalog
+func (d *Daemon) AutoRepair() *AutoRepair {
+	return d.repair
+}
+
+// Serve serves the API and runs the background repair until the context is done,
+// then waits for the open requests and cancels the jobs
+func (d *Daemon) Serve(ctx context.Context) error {
+	repairCtx, stopRepair := context.WithCancel(ctx)
+	repairDone := make(chan struct{})
+	go func() {
+		defer close(repairDone)
+		d.repair.Run(repairCtx)
+	}()
+
+	d.logger.Info("Daemon is listening", "addr", d.option.Addr, "state", d.option.StateDir)
+	err := util.ListenAndServe(ctx, &http.Server{Addr: d.option.Addr, Handler: d.Handler()})
+	stopRepair()
+	<-repairDone
+	d.jobs.Close()
+	d.logger.Info("Daemon stopped")
+
+	return err
+}
+
+// resolve finds the metadata CID of a file of the catalog
+func (d *Daemon) resolve(rootCID string) (metaCID string, ok bool) {
+	entry, ok := d.files.Get(rootCID)
+	return entry.MetaCID, ok && len(entry.MetaCID) > 0
+}
+
+// outputPath returns the path of the file downloaded by the job
+func (d *Daemon) outputPath(id string) string {
+	return filepath.Join(d.option.StateDir, downloadDir, id)
+}
@@ -0,0 +1,229 @@
+package daemon
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sort"
+	"sync"
+	"time"
+)
+
+// JobState is the lifecycle state of a job
+type JobState string
+
+const (
+	JobQueued    JobState = "queued"
+	JobRunning   JobState = "running"
+	JobSucceeded JobState = "succeeded"
+	JobFailed    JobState = "failed"
+	JobCancelled JobState = "cancelled"
+)
+
+// Finished returns whether the job will not change anymore
+func (s JobState) Finished() bool {
+	return s == JobSucceeded || s == JobFailed || s == JobCancelled
+}
+
+// JobProgress is the progress of the current stage of a job. Total is 0 if unknown
+type JobProgress struct {
+	Stage string
+	Done  int64
+	Total int64
+}
+
+// JobStatus is a snapshot of a job returned by the API
+type JobStatus struct {
+	ID    string
+	Kind  string
+	State JobState
+
+	Created  time.Time
+	Started  *time.Time `json:",omitempty"`
+	Finished *time.Time `json:",omitempty"`
+
+	Progress JobProgress
+	Error    string      `json:",omitempty"`
+	Result   interface{} `json:",omitempty"`
+}
+
+// JobFunc runs a job. It reports its progress to the job and returns its result
+type JobFunc func(ctx context.Context, job *Job) (result interface{}, err error)
+
+// Job is an operation running in the background of the daemon
+type Job struct {
+	*sync.Mutex
+
+	status JobStatus
+	cancel context.CancelFunc
+}
+
+// ID returns the identifier of the job
+func (j *Job) ID() string {
+	return j.status.ID
+}
+
+// Status returns a snapshot of the job
+func (j *Job) Status() JobStatus {
+	j.Lock()
+	defer j.Unlock()
+	return j.status
+}
+
+// Report records the progress of the job. It has the signature of client.Progress
+func (j *Job) Report(stage string, done int64, total int64) {
+	j.Lock()
+	defer j.Unlock()
+	j.status.Progress = JobProgress{Stage: stage, Done: done, Total: total}
+}
+
+// setState moves the job to the state, unless it is already finished
+func (j *Job) setState(state JobState, result interface{}, err error) {
+	j.Lock()
+	defer j.Unlock()
+	if j.status.State.Finished() {
+		return
+	}
+	now := time.Now()
+	j.status.State = state
+	switch {
+	case state == JobRunning:
+		j.status.Started = &now
+	case state.Finished():
+		j.status.Finished = &now
+		j.status.Result = result
+		if err != nil {
+			j.status.Error = err.Error()
+		}
+	}
+}
+
+// Jobs runs the jobs of the daemon with a bounded concurrency and keeps them until they are removed
+type Jobs struct {
+	*sync.Mutex
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	slots  chan struct{}
+	jobs   map[string]*Job
+	wg     sync.WaitGroup
+}
+
+// NewJobs creates a job manager running at most maxJobs jobs at the same time
+func NewJobs(maxJobs int) *Jobs {
+	if maxJobs <= 0 {
+		maxJobs = DefaultMaxJobs
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Jobs{
+		Mutex:  &sync.Mutex{},
+		ctx:    ctx,
+		cancel: cancel,
+		slots:  make(chan struct{}, maxJobs),
+		jobs:   make(map[string]*Job),
+	}
+}
+
+// Submit queues the job and returns it. The job starts once a slot is free.
+// The optional release is called once the job is finished, even if it is cancelled before starting
+func (m *Jobs) Submit(kind string, run JobFunc, release func()) *Job {
+	ctx, cancel := context.WithCancel(m.ctx)
+	job := &Job{
+		Mutex:  &sync.Mutex{},
+		status: JobStatus{ID: newJobID(), Kind: kind, State: JobQueued, Created: time.Now()},
+		cancel: cancel,
+	}
+	m.Lock()
+	m.jobs[job.ID()] = job
+	m.Unlock()
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer cancel()
+		if release != nil {
+			defer release()
+		}
+
+		select {
+		case m.slots <- struct{}{}:
+		case <-ctx.Done():
+			job.setState(JobCancelled, nil, ctx.Err())
+			return
+		}
+		defer func() { <-m.slots }()
+
+		job.setState(JobRunning, nil, nil)
+		result, err := run(ctx, job)
+		switch {
+		case ctx.Err() != nil:
+			job.setState(JobCancelled, result, ctx.Err())
+		case err != nil:
+			job.setState(JobFailed, result, err)
+		default:
+			job.setState(JobSucceeded, result, nil)
+		}
+	}()
+
+	return job
+}
+
+// Get returns the job with the ID
+func (m *Jobs) Get(id string) (*Job, bool) {
+	m.Lock()
+	defer m.Unlock()
+	job, ok := m.jobs[id]
+	return job, ok
+}
+
+// List returns the status of every job, the oldest first
+func (m *Jobs) List() []JobStatus {
+	m.Lock()
+	statuses := make([]JobStatus, 0, len(m.jobs))
+	for _, job := range m.jobs {
+		statuses = append(statuses, job.Status())
+	}
+	m.Unlock()
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Created.Before(statuses[j].Created)
+	})
+	return statuses
+}
+
+// Cancel stops the job if it has not finished yet
+func (m *Jobs) Cancel(id string) bool {
+	job, ok := m.Get(id)
+	if ok {
+		job.cancel()
+	}
+	return ok
+}
+
+// Remove forgets a finished job. It returns false if the job is unknown or still running
+func (m *Jobs) Remove(id string) bool {
+	m.Lock()
+	defer m.Unlock()
+	job, ok := m.jobs[id]
+	if !ok || !job.Status().State.Finished() {
+		return false
+	}
+	delete(m.jobs, id)
+	return true
+}
+
+// Close cancels every job and waits for them to stop
+func (m *Jobs) Close() {
+	m.cancel()
+	m.wg.Wait()
+}
+
+// newJobID returns a random identifier
+func newJobID() string {
+	id := make([]byte, 8)
+	_, err := rand.Read(id)
+	if err != nil {
+		return time.Now().Format("20060102150405.000000000")
+	}
+	return hex.EncodeToString(id)
+}
@@ -1,7 +1,6 @@
 package entangler
 
 import (
-	"context"
 	"sync"
 
 	"golang.org/x/xerrors"
@@ -86,49 +85,46 @@ func (b *Block) IsRepaired() bool {
 	return b.Repaired
 }
 
-// StartRepair sets the block's status to RepairPending if no previous attempt
-func (b *Block) StartRepair(ctx context.Context, rid uint) bool {
+// TryStartRepair sets the block's status to RepairPending if no previous attempt, without waiting
+// for the repair of another request. busy reports that another request is repairing the block
+func (b *Block) TryStartRepair(rid uint) (started bool, busy bool) {
 	b.Lock()
 	defer b.Unlock()
-	for {
-		select {
-		case <-ctx.Done():
-			b.waitingGroup.Broadcast()
-			return false
-		default:
-			if b.Status == RepairPending {
-				if b.currRequest == rid {
-					// already visited by the request
-					return false
-				}
-				b.waitingGroup.Wait()
-			} else if b.Status == DataAvailable {
-				return false
-			} else {
-				b.Status = RepairPending
-				b.currRequest = rid
-				return true
-			}
-		}
+
+	switch b.Status {
+	case DataAvailable:
+		return false, false
+	case RepairPending:
+		return false, b.currRequest != rid
 	}
+	b.Status = RepairPending
+	b.currRequest = rid
+	return true, false
 }
 
-// FinishRepair update the block status and wake the waiting thread
-func (b *Block) FinishRepair(success bool) {
+// WaitRepair waits until the pending repair of the block finishes
+func (b *Block) WaitRepair() {
 	b.Lock()
 	defer b.Unlock()
-	shouldUpdate := b.Status == RepairPending
-	if success {
-		if shouldUpdate {
+
+	for b.Status == RepairPending {
+		b.waitingGroup.Wait()
+	}
+}
+
+// FinishRepair update the block status and wake the waiting threads. Only the request that
+// started the pending repair can finish it
+func (b *Block) FinishRepair(success bool, rid uint) {
+	b.Lock()
+	defer b.Unlock()
+	if b.Status == RepairPending && b.currRequest == rid {
+		if success {
 			b.Status = DataAvailable
-		}
-		b.waitingGroup.Broadcast()
-	} else {
-		if shouldUpdate {
+		} else {
 			b.Status = NoData
 		}
-		b.waitingGroup.Signal()
 	}
+	b.waitingGroup.Broadcast()
 }
 
 // SetData sets the chunk data inside the block
@@ -143,6 +139,21 @@ func (b *Block) SetData(data []byte, isRecover bool) {
 	}
 }
 
+// Release drops the chunk data so that it can be garbage collected. The block is downloaded
+// or repaired again if it is needed later. A block with a pending repair is kept
+func (b *Block) Release() bool {
+	b.Lock()
+	defer b.Unlock()
+
+	if b.Status != DataAvailable {
+		return false
+	}
+	b.Data = nil
+	b.Status = NoData
+	b.Repaired = false
+	return true
+}
+
 // Recover recovers the block by xoring two given chunk
 func (b *Block) Recover(v []byte, w []byte) (err error) {
 	if len(v) == 0 || len(w) == 0 {
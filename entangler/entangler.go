@@ -1,6 +1,9 @@
 package entangler
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"ipfs-alpha-entanglement-code/util"
 	"os"
 
@@ -40,6 +43,13 @@ func NewEntangledBlock(l int, r int, data []byte, strand int) (block *EntangledB
 	return block
 }
 
+// ParityDigest returns the integrity digest of the parity data. The trailing zeros are ignored
+// since a recovered parity may carry more padding than the uploaded one
+func ParityDigest(data []byte) string {
+	hash := sha256.Sum256(bytes.TrimRight(data, "\x00"))
+	return hex.EncodeToString(hash[:])
+}
+
 // Entangler manages all the entanglement related behaviors
 type Entangler struct {
 	Alpha    int // now only support alpha = 3
@@ -50,32 +60,44 @@ type Entangler struct {
 	ChainStartData       [][]byte
 	MaxChainNumPerStrand int
 
+	Logger *util.Logger
+
 	// cached data. reset for each entanglement
 	cachedParities     [][]*EntangledBlock
 	parityBlocksToWrap [][]*EntangledBlock
 }
 
-// NewEntangler takes the entanglement paramters and the original data slice and creates an entangler
-func NewEntangler(alpha int, s int, p int) (entangler *Entangler) {
-	// value check. See details in alpha-entanglement-code paper (https://ieeexplore.ieee.org/document/8416482)
-	if alpha < 1 {
-		util.ThrowError("invalid value. Expect alpha > 0")
-	}
-	if alpha == 1 && !(s == 1 && p == 0) {
-		util.ThrowError("invalid value. Expect s = 1 and p = 0")
-	}
-	if alpha > 1 && s > p {
-		util.ThrowError("invalid value. Expect p >= s")
+// NewEntangler takes the entanglement paramters and the original data slice and creates an entangler.
+// Invalid parameters return an error matching ErrInvalidParameters
+func NewEntangler(alpha int, s int, p int) (entangler *Entangler, err error) {
+	err = ValidateParameters(alpha, s, p)
+	if err != nil {
+		return nil, err
 	}
 
-	entangler = &Entangler{Alpha: alpha, S: s, P: p}
+	entangler = &Entangler{Alpha: alpha, S: s, P: p, Logger: util.Default()}
 	if s > p {
 		entangler.MaxChainNumPerStrand = s
 	} else {
 		entangler.MaxChainNumPerStrand = p
 	}
 
-	return entangler
+	return entangler, nil
+}
+
+// ValidateParameters checks the entanglement parameters.
+// See details in alpha-entanglement-code paper (https://ieeexplore.ieee.org/document/8416482)
+func ValidateParameters(alpha int, s int, p int) error {
+	if alpha < 1 || alpha > 3 {
+		return xerrors.Errorf("expect 0 < alpha <= 3, got %d: %w", alpha, ErrInvalidParameters)
+	}
+	if alpha == 1 && !(s == 1 && p == 0) {
+		return xerrors.Errorf("expect s = 1 and p = 0 when alpha = 1: %w", ErrInvalidParameters)
+	}
+	if alpha > 1 && (s < 1 || s > p) {
+		return xerrors.Errorf("expect 0 < s <= p, got s = %d and p = %d: %w", s, p, ErrInvalidParameters)
+	}
+	return nil
 }
 
 // WriteEntanglementToFile writes the entanglement into files
@@ -90,7 +112,7 @@ func (e *Entangler) WriteEntanglementToFile(chunkSize int, path []string, parity
 		parities[k] = make([][]byte, e.ChunkNum)
 	}
 	for parity := range parityChan {
-		util.InfoPrintf(util.Yellow("Strand %d: (%d, %d)\n"), parity.Strand, parity.LeftBlockIndex, parity.RightBlockIndex)
+		e.Logger.Debug("Write parity", "strand", parity.Strand, "left", parity.LeftBlockIndex, "right", parity.RightBlockIndex)
 		parities[parity.Strand][parity.LeftBlockIndex-1] = parity.Data
 	}
 
@@ -118,12 +140,13 @@ func (e *Entangler) WriteEntanglementToFile(chunkSize int, path []string, parity
 	return err
 }
 
-// Entangle generate the entangelement for the given arrray of blocks
+// Entangle generate the entangelement for the given arrray of blocks. The parity channel is closed on return
 func (e *Entangler) Entangle(dataChan chan []byte, parityChan chan EntangledBlock) error {
+	defer close(parityChan)
 	e.prepareEntangle()
 
 	// generate the lattice
-	util.LogPrintf("Start generating lattice")
+	e.Logger.Info("Start generating lattice")
 	index := 0
 	for block := range dataChan {
 		index++
@@ -133,14 +156,12 @@ func (e *Entangler) Entangle(dataChan chan []byte, parityChan chan EntangledBloc
 		}
 	}
 	e.ChunkNum = index
-	util.LogPrintf("Finish generating lattice")
+	e.Logger.Info("Finish generating lattice", "chunks", index)
 
 	// wraps the lattice
-	util.LogPrintf("Start wrapping lattice")
+	e.Logger.Info("Start wrapping lattice")
 	e.wrapLattice(parityChan)
-	util.LogPrintf("Finish wrapping lattice")
-
-	close(parityChan)
+	e.Logger.Info("Finish wrapping lattice")
 
 	return nil
 }
@@ -279,11 +300,8 @@ func (e *Entangler) getChainStartIndexes(index int) (indexes []int) {
 
 // getForwardNeighborIndexes returns the index of forward neighbors that is the entangled output of current node
 // See details in alpha-entanglement-code paper (https://ieeexplore.ieee.org/document/8416482)
+// alpha is at most 3, see ValidateParameters
 func (e *Entangler) getForwardNeighborIndexes(index int) (indexes []int) {
-	if e.Alpha > 3 {
-		util.ThrowError("alpha should equal 3")
-	}
-
 	// d_i creates entangled block p_{i,j}
 	pos := e.getPositionCategory(index)
 	var h, rh, lh int
@@ -0,0 +1,36 @@
+package entangler
+
+import (
+	"fmt"
+
+	"golang.org/x/xerrors"
+)
+
+var (
+	// ErrInvalidParameters is returned for entanglement parameters or block indexes out of range
+	ErrInvalidParameters = xerrors.New("invalid parameters")
+	// ErrBlockUnrecoverable is matched by the errors of the blocks that could not be downloaded nor repaired
+	ErrBlockUnrecoverable = xerrors.New("block unrecoverable")
+)
+
+// RecoveryError is returned when a block can neither be downloaded nor repaired.
+// It matches ErrBlockUnrecoverable
+type RecoveryError struct {
+	Block BlockRef
+	Err   error
+}
+
+// Error describes the block and the last failure
+func (e *RecoveryError) Error() string {
+	return fmt.Sprintf("fail to recover %s: %s", e.Block, e.Err)
+}
+
+// Unwrap returns the last failure
+func (e *RecoveryError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the target is ErrBlockUnrecoverable
+func (e *RecoveryError) Is(target error) bool {
+	return target == ErrBlockUnrecoverable
+}
@@ -0,0 +1,87 @@
+package entangler
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Hedger decides when the lattice starts repairing a block whose direct download is still pending.
+// On IPFS, a missing block usually shows up as a long hang rather than an error
+type Hedger interface {
+	// Delay returns how long a direct download may run before a repair is started in parallel
+	Delay() time.Duration
+	// Observe records the latency of a successful direct download
+	Observe(latency time.Duration)
+}
+
+// FixedHedger starts the repair after a fixed delay
+type FixedHedger struct {
+	Threshold time.Duration
+}
+
+// Delay returns the fixed threshold
+func (h *FixedHedger) Delay() time.Duration {
+	return h.Threshold
+}
+
+// Observe ignores the latency
+func (h *FixedHedger) Observe(latency time.Duration) {}
+
+// LearnedHedger learns the delay from the observed download latencies, the same way TCP
+// estimates its retransmission timeout: smoothed mean plus four times the mean deviation.
+// The IPFS API does not tell which peer served a block, so the latency is learned per node
+type LearnedHedger struct {
+	*sync.Mutex
+
+	Min time.Duration
+	Max time.Duration
+
+	mean      float64
+	deviation float64
+	samples   int
+}
+
+// NewLearnedHedger creates a hedger whose delay stays within [min, max]. It waits max until
+// the first download succeeds
+func NewLearnedHedger(min time.Duration, max time.Duration) *LearnedHedger {
+	return &LearnedHedger{
+		Mutex: &sync.Mutex{},
+		Min:   min,
+		Max:   max,
+	}
+}
+
+// Delay returns the learned delay
+func (h *LearnedHedger) Delay() time.Duration {
+	h.Lock()
+	defer h.Unlock()
+
+	if h.samples == 0 {
+		return h.Max
+	}
+	delay := time.Duration(h.mean + 4*h.deviation)
+	if delay < h.Min {
+		return h.Min
+	}
+	if delay > h.Max {
+		return h.Max
+	}
+	return delay
+}
+
+// Observe updates the estimation with the latency
+func (h *LearnedHedger) Observe(latency time.Duration) {
+	h.Lock()
+	defer h.Unlock()
+
+	sample := float64(latency)
+	if h.samples == 0 {
+		h.mean = sample
+		h.deviation = sample / 2
+	} else {
+		h.deviation = 0.75*h.deviation + 0.25*math.Abs(h.mean-sample)
+		h.mean = 0.875*h.mean + 0.125*sample
+	}
+	h.samples++
+}
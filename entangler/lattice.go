@@ -2,8 +2,8 @@ package entangler
 
 import (
 	"context"
-	"ipfs-alpha-entanglement-code/util"
 	"sync"
+	"time"
 
 	"golang.org/x/xerrors"
 )
@@ -13,6 +13,26 @@ type BlockGetter interface {
 	GetParity(index int, strand int) ([]byte, error)
 }
 
+// ContextBlockGetter is implemented by the getters able to abandon a download, so that
+// the losing path of a hedged retrieval is cancelled
+type ContextBlockGetter interface {
+	GetDataContext(ctx context.Context, index int) ([]byte, error)
+	GetParityContext(ctx context.Context, index int, strand int) ([]byte, error)
+}
+
+// BlockVerifier is implemented by the getters able to check the integrity of a recovered data chunk
+type BlockVerifier interface {
+	// VerifyData checks the recovered chunk against the expected content of the indexed block
+	// and returns the chunk without the padding added by the recovery
+	VerifyData(index int, data []byte) ([]byte, error)
+}
+
+// ParityVerifier is implemented by the getters able to check the integrity of a parity
+type ParityVerifier interface {
+	// VerifyParity checks the parity against the digest of the indexed parity block on the strand
+	VerifyParity(index int, strand int, data []byte) error
+}
+
 type Lattice struct {
 	*sync.Mutex
 
@@ -26,11 +46,34 @@ type Lattice struct {
 	requestCounter uint
 
 	SwitchDepth uint
+	Strategy    RecoveryStrategy
+
+	// starts the repair of slow downloads in parallel. Nil waits for the download to fail
+	Hedger Hedger
+
+	// receives the events of the recovery. Nil ignores them
+	Observer Observer
+
+	stats recoveryStats
+
+	// bound the goroutines of the parallel recovery and the concurrent downloads
+	workers   *workerPool
+	downloads *scheduler
+	// blocks found under repair by another request, per parallel request
+	busy map[uint][]*Block
 }
 
-// NewLattice creates a new lattice for block downloading and recovering
-func NewLattice(alpha int, s int, p int, blockNum int, blockGetter BlockGetter, switchDepth uint) (lattice *Lattice) {
-	var tangler = *NewEntangler(alpha, s, p)
+// NewLattice creates a new lattice for block downloading and recovering.
+// Invalid parameters return an error matching ErrInvalidParameters
+func NewLattice(alpha int, s int, p int, blockNum int, blockGetter BlockGetter, switchDepth uint) (lattice *Lattice, err error) {
+	if blockNum < 0 {
+		return nil, xerrors.Errorf("expect a non-negative number of chunks, got %d: %w", blockNum, ErrInvalidParameters)
+	}
+	entangler, err := NewEntangler(alpha, s, p)
+	if err != nil {
+		return nil, err
+	}
+	var tangler = *entangler
 	tangler.ChunkNum = blockNum
 	lattice = &Lattice{
 		Mutex:        &sync.Mutex{},
@@ -39,9 +82,21 @@ func NewLattice(alpha int, s int, p int, blockNum int, blockGetter BlockGetter,
 		ParityBlocks: make([][]*Block, alpha),
 		Getter:       blockGetter,
 		SwitchDepth:  switchDepth,
+		Observer:     LogObserver{Logger: tangler.Logger},
+		workers:      newWorkerPool(DefaultRecoveryWorkers),
+		downloads:    newScheduler(DefaultMaxDownloads),
+		busy:         map[uint][]*Block{},
 	}
 
-	return lattice
+	return lattice, nil
+}
+
+// SetConcurrency sets the lattice-wide budget: the number of goroutines of the parallel recovery
+// and the number of concurrent downloads, shared fairly between the chunk requests.
+// It must be called before the lattice is used
+func (l *Lattice) SetConcurrency(workers int, downloads int) {
+	l.workers = newWorkerPool(workers)
+	l.downloads = newScheduler(downloads)
 }
 
 // Init inits the lattice by creating the entire structure in memory
@@ -50,7 +105,7 @@ func (l *Lattice) Init() {
 		l.initDataBlocks()
 		l.initParityBlocks()
 		l.initLinks()
-		util.LogPrintf("Finish initializing lattice")
+		l.Logger.Info("Finish initializing lattice", "chunks", l.ChunkNum, "alpha", l.Alpha)
 	})
 }
 
@@ -70,62 +125,184 @@ func (l *Lattice) GetAllData() (data [][]byte, err error) {
 
 // GetChunk returns a data chunk in the indexed block
 func (l *Lattice) GetChunk(index int) (data []byte, repaired bool, err error) {
-	block := l.getBlock(index)
-	data, err = l.getDataFromBlock(block, l.SwitchDepth)
+	return l.GetChunkContext(context.Background(), index)
+}
+
+// GetChunkContext returns a data chunk in the indexed block. The recovery is abandoned when the context is done
+func (l *Lattice) GetChunkContext(ctx context.Context, index int) (data []byte, repaired bool, err error) {
+	block, err := l.getBlock(index)
+	if err != nil {
+		return nil, false, err
+	}
+	data, err = l.getDataFromBlock(ctx, block, l.SwitchDepth)
+	repaired = block.IsRepaired()
+
+	return data, repaired, err
+}
+
+// GetParity returns the parity in the indexed block of the strand. Missing parity is recovered
+// the same way as the data chunk, so that it can be re-published
+func (l *Lattice) GetParity(index int, strand int) (data []byte, repaired bool, err error) {
+	return l.GetParityContext(context.Background(), index, strand)
+}
+
+// GetParityContext returns the parity in the indexed block of the strand. The recovery is abandoned
+// when the context is done
+func (l *Lattice) GetParityContext(ctx context.Context, index int, strand int) (data []byte, repaired bool, err error) {
+	block, err := l.getParityBlock(index, strand)
+	if err != nil {
+		return nil, false, err
+	}
+	data, err = l.getDataFromBlock(ctx, block, l.SwitchDepth)
 	repaired = block.IsRepaired()
 
 	return data, repaired, err
 }
 
+// ReleaseChunk releases the data of the indexed block once it has been consumed, together with
+// the parities on its left. They only serve the recovery of the block and of the blocks before it,
+// so that the memory is bounded by the lattice window instead of the file size.
+// Parities wrapping the end of the lattice to its beginning are kept
+func (l *Lattice) ReleaseChunk(index int) error {
+	block, err := l.getBlock(index)
+	if err != nil {
+		return err
+	}
+	block.Release()
+	for _, parity := range block.LeftNeighbors {
+		if parity != nil && !parity.IsWrapModified {
+			parity.Release()
+		}
+	}
+
+	return nil
+}
+
 // getBlock returns an original data block with the given index
-func (l *Lattice) getBlock(index int) (block *Block) {
+func (l *Lattice) getBlock(index int) (block *Block, err error) {
+	if index < 1 || index > len(l.DataBlocks) {
+		return nil, xerrors.Errorf("invalid data index %d: %w", index, ErrInvalidParameters)
+	}
 	block = l.DataBlocks[index-1]
-	return block
+	return block, nil
+}
+
+// getParityBlock returns a parity block with the given index on the strand
+func (l *Lattice) getParityBlock(index int, strand int) (block *Block, err error) {
+	if strand < 0 || strand >= len(l.ParityBlocks) {
+		return nil, xerrors.Errorf("invalid strand %d: %w", strand, ErrInvalidParameters)
+	}
+	if index < 1 || index > len(l.ParityBlocks[strand]) {
+		return nil, xerrors.Errorf("invalid parity index %d: %w", index, ErrInvalidParameters)
+	}
+	block = l.ParityBlocks[strand][index-1]
+	return block, nil
 }
 
-// getDataFromBlock recovers a block with missing chunk using the lattice (hybrid, auto switch)
-func (l *Lattice) getDataFromBlock(block *Block, allowDepth uint) ([]byte, error) {
+// getDataFromBlock recovers a block with missing chunk using the lattice, following the strategy
+func (l *Lattice) getDataFromBlock(parent context.Context, block *Block, allowDepth uint) ([]byte, error) {
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	switch l.Strategy {
+	case SequentialStrategy:
+		return l.getDataFromBlockSequential(ctx, block, l.getRequestID(), allowDepth)
+	case ParallelStrategy:
+		return l.getDataFromBlockParallel(ctx, block, l.getRequestID())
+	case AdaptiveStrategy:
+		// escalate step by step so that the cheapest recovery is tried first.
+		// The blocks found missing by a step are not downloaded again by the next ones
+		ctx = withMissingBlocks(ctx)
+		maxDepth := l.adaptiveDepth()
+		for depth := uint(1); depth <= maxDepth; depth++ {
+			data, err := l.getDataFromBlockSequential(ctx, block, l.getRequestID(), depth)
+			if err == nil || ctx.Err() != nil {
+				return data, err
+			}
+		}
+		return l.getDataFromBlockParallel(ctx, block, l.getRequestID())
+	}
+
+	// hybrid, auto switch
 	rid := l.getRequestID()
 	if allowDepth > 0 {
-		data, err := l.getDataFromBlockSequential(block, rid, allowDepth)
-		if err == nil {
-			return data, nil
+		data, err := l.getDataFromBlockSequential(ctx, block, rid, allowDepth)
+		if err == nil || ctx.Err() != nil {
+			return data, err
 		}
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
 	return l.getDataFromBlockParallel(ctx, block, rid)
 }
 
-// getDataFromBlockSequential recovers a block with missing chunk using the lattice (single thread)
-func (l *Lattice) getDataFromBlockSequential(block *Block, rid uint, allowDepth uint) (data []byte, err error) {
-	l.sequentialRecoverHelper(block, rid, allowDepth)
-
-	data, err = block.GetData()
+// getDataFromBlockSequential recovers a block with missing chunk using the lattice (single thread).
+// Like the parallel recovery, it does not wait for the blocks under repair by other requests while
+// it holds blocks, since two requests could wait for each other. It waits for them afterwards, and tries again
+func (l *Lattice) getDataFromBlockSequential(ctx context.Context, block *Block, rid uint,
+	allowDepth uint) (data []byte, err error) {
+	for {
+		l.sequentialRecoverHelper(withRequest(ctx, rid), block, rid, allowDepth)
+		data, err = block.GetData()
+		busy := l.takeBusyBlocks(rid)
+		if err == nil || len(busy) == 0 || ctx.Err() != nil {
+			break
+		}
+		for _, busyBlock := range busy {
+			busyBlock.WaitRepair()
+		}
+		rid = l.getRequestID()
+	}
 	if err != nil {
-		err = xerrors.Errorf("fail to recover block %d (parity: %t. strand: %d): %s.",
-			block.Index, block.IsParity, block.Strand, err)
+		err = &RecoveryError{Block: block.ref(), Err: err}
 	}
 
 	return data, err
 }
 
-// getDataFromBlockParallel recovers a block with missing chunk using the lattice (multiple threads)
+// getDataFromBlockParallel recovers a block with missing chunk using the lattice (multiple threads).
+// The recovery does not wait for the blocks under repair by other requests, since it may run inline
+// when the worker budget is exhausted and such waits could deadlock. The request waits for
+// them once it holds no block anymore, and tries again
 func (l *Lattice) getDataFromBlockParallel(ctx context.Context, block *Block, rid uint) (data []byte, err error) {
-	myChannel := make(chan bool, 1)
-	l.parallelRecoverHelper(ctx, block, rid, myChannel)
-	<-myChannel
-	data, err = block.GetData()
+	for {
+		myChannel := make(chan bool, 1)
+		l.parallelRecoverHelper(withRequest(ctx, rid), block, rid, myChannel)
+		<-myChannel
+		data, err = block.GetData()
+		busy := l.takeBusyBlocks(rid)
+		if err == nil || len(busy) == 0 || ctx.Err() != nil {
+			break
+		}
+		for _, busyBlock := range busy {
+			busyBlock.WaitRepair()
+		}
+		rid = l.getRequestID()
+	}
 	if err != nil {
-		err = xerrors.Errorf("fail to recover block %d (parity: %t. strand: %d): %s.",
-			block.Index, block.IsParity, block.Strand, err)
+		err = &RecoveryError{Block: block.ref(), Err: err}
 	}
 
 	return data, err
 }
 
+// addBusyBlock records a block found under repair by another request
+func (l *Lattice) addBusyBlock(rid uint, block *Block) {
+	l.Lock()
+	defer l.Unlock()
+
+	l.busy[rid] = append(l.busy[rid], block)
+}
+
+// takeBusyBlocks returns and forgets the blocks found under repair by other requests
+func (l *Lattice) takeBusyBlocks(rid uint) []*Block {
+	l.Lock()
+	defer l.Unlock()
+
+	busy := l.busy[rid]
+	delete(l.busy, rid)
+	return busy
+}
+
 // initDataBlocks inits data blocks when init lattice
 func (l *Lattice) initDataBlocks() {
 	// Create datablocks
@@ -179,11 +356,129 @@ func (l *Lattice) initLinks() {
 	}
 }
 
-// downloadBlock downloads data/parity blocks using the Getter passed in
-func (l *Lattice) downloadBlock(block *Block) (err error) {
+// retrieveBlock downloads the block and repairs it if the download fails. With a hedger, the repair
+// also starts when the download is still pending after the hedging delay. The first path to
+// succeed wins and the other one is cancelled. The repair returns the pair used, nil if it fails.
+// A block already found missing by the recovery is directly repaired
+func (l *Lattice) retrieveBlock(ctx context.Context, block *Block, rid uint, isParallel bool,
+	repair func(context.Context) *BlockPair) bool {
+
+	missing := missingOf(ctx)
+	downloading := !missing.has(block)
+
+	var hedge <-chan time.Time
+	if l.Hedger != nil {
+		timer := time.NewTimer(l.Hedger.Delay())
+		defer timer.Stop()
+		hedge = timer.C
+	}
+
+	// the scheduler bounds the downloads, the workers are kept for the repair
+	downloadCtx, cancelDownload := context.WithCancel(ctx)
+	defer cancelDownload()
+	downloaded := make(chan error, 1)
+	start := time.Now()
+	if downloading {
+		go func() { downloaded <- l.downloadBlock(downloadCtx, block, rid, isParallel) }()
+	}
+
+	repairCtx, cancelRepair := context.WithCancel(ctx)
+	defer cancelRepair()
+	repaired := make(chan *BlockPair, 1)
+	var repairStart time.Time
+	startRepair := func() {
+		repairStart = time.Now()
+		l.workers.Go(func() { repaired <- repair(repairCtx) })
+	}
+
+	repairing := false
+	if !downloading {
+		repairing = true
+		startRepair()
+	}
+	for downloading || repairing {
+		select {
+		case err := <-downloaded:
+			downloading = false
+			if err == nil {
+				if l.Hedger != nil {
+					l.Hedger.Observe(time.Since(start))
+				}
+				return true
+			}
+			if downloadCtx.Err() == nil {
+				missing.add(block)
+			}
+			if !repairing {
+				repairing = true
+				startRepair()
+			}
+		case <-hedge:
+			if !repairing {
+				l.emit(ctx, Event{Type: EventHedge, Block: block.ref(), Parallel: isParallel,
+					Duration: time.Since(start)})
+				repairing = true
+				startRepair()
+			}
+		case pair := <-repaired:
+			repairing = false
+			event := Event{Type: EventRepairFail, Block: block.ref(), Parallel: isParallel,
+				Duration: time.Since(repairStart)}
+			if pair != nil {
+				event.Type = EventRepairSuccess
+				event.Left, event.Right = pair.Left.ref(), pair.Right.ref()
+				if data, err := block.GetData(); err == nil {
+					event.Size = len(data)
+				}
+				l.emit(ctx, event)
+				return true
+			}
+			l.emit(ctx, event)
+		}
+	}
+
+	return false
+}
+
+// downloadBlock downloads data/parity blocks using the Getter passed in, once the scheduler
+// gives the turn to the request. A corrupted parity is reported as missing so that the recovery goes around it
+func (l *Lattice) downloadBlock(ctx context.Context, block *Block, rid uint, isParallel bool) (err error) {
+	err = l.downloads.Acquire(ctx, rid)
+	if err != nil {
+		return err
+	}
+	defer l.downloads.Release()
+
+	start := time.Now()
+	l.emit(ctx, Event{Type: EventDownloadStart, Block: block.ref(), Parallel: isParallel, Time: start})
 	var data []byte
+	defer func() {
+		event := Event{Type: EventDownloadSuccess, Block: block.ref(), Parallel: isParallel,
+			Duration: time.Since(start), Size: len(data), Err: err}
+		// a cancelled download says nothing about the availability of the block
+		if ctx.Err() != nil {
+			event.Type = EventDownloadCancel
+		} else {
+			l.stats.observe(event.Duration, err)
+			if err != nil {
+				event.Type = EventDownloadFail
+			}
+		}
+		l.emit(ctx, event)
+	}()
+
+	getter, cancellable := l.Getter.(ContextBlockGetter)
 	if block.IsParity {
-		data, err = l.Getter.GetParity(block.Index, block.Strand)
+		if cancellable {
+			data, err = getter.GetParityContext(ctx, block.Index, block.Strand)
+		} else {
+			data, err = l.Getter.GetParity(block.Index, block.Strand)
+		}
+		if err == nil {
+			err = l.verifyParity(ctx, block, data)
+		}
+	} else if cancellable {
+		data, err = getter.GetDataContext(ctx, block.Index)
 	} else {
 		data, err = l.Getter.GetData(block.Index)
 	}
@@ -194,6 +489,52 @@ func (l *Lattice) downloadBlock(block *Block) (err error) {
 	return err
 }
 
+// verifyParity checks the parity against its digest if the getter supports it
+func (l *Lattice) verifyParity(ctx context.Context, block *Block, data []byte) error {
+	verifier, ok := l.Getter.(ParityVerifier)
+	if !ok {
+		return nil
+	}
+	err := verifier.VerifyParity(block.Index, block.Strand, data)
+	if err != nil {
+		l.emit(ctx, Event{Type: EventReject, Block: block.ref(), Size: len(data), Err: err})
+	}
+	return err
+}
+
+// recoverBlock recovers the block from the chunks of the pair. The recovered chunk is verified
+// if the getter supports it, so that a corrupted pair is rejected instead of returning bad bytes
+func (l *Lattice) recoverBlock(ctx context.Context, block *Block, pair *BlockPair,
+	leftChunk []byte, rightChunk []byte) (err error) {
+	if len(leftChunk) == 0 || len(rightChunk) == 0 {
+		return xerrors.Errorf("invalid recover input!")
+	}
+
+	var data []byte
+	if pair.Left == pair.Right {
+		// special case: wrap on itself
+		data = leftChunk
+	} else {
+		data = xorChunkData(leftChunk, rightChunk)
+	}
+
+	if block.IsParity {
+		err = l.verifyParity(ctx, block, data)
+		if err != nil {
+			return err
+		}
+	} else if verifier, ok := l.Getter.(BlockVerifier); ok {
+		data, err = verifier.VerifyData(block.Index, data)
+		if err != nil {
+			l.emit(ctx, Event{Type: EventReject, Block: block.ref(), Size: len(data), Err: err})
+			return err
+		}
+	}
+
+	block.SetData(data, true)
+	return nil
+}
+
 // generate uniq id for the request
 func (l *Lattice) getRequestID() uint {
 	l.Lock()
@@ -204,97 +545,97 @@ func (l *Lattice) getRequestID() uint {
 	return id
 }
 
-// sequentialRepair repairs a block using single thread
-func (l *Lattice) sequentialRepair(block *Block, rid uint, allowDepth uint) bool {
+// sequentialRepair repairs a block using single thread. It returns the pair used, nil if it fails
+func (l *Lattice) sequentialRepair(ctx context.Context, block *Block, rid uint, allowDepth uint) *BlockPair {
 	if allowDepth == 0 {
-		return false
+		return nil
 	}
 	pairs := block.GetRecoverPairs()
 	if len(pairs) == 0 {
-		return false
+		return nil
 	}
 
+	pairCtx := deeper(ctx)
 	for _, mypair := range pairs {
-		util.InfoPrintf(util.Yellow("{Parallel} Left - Index: %d, Parity: %t, Strand: %d\n"+
-			"Right - Index: %d, Parity: %t, Strand: %d\n\n"),
-			mypair.Left.Index, mypair.Left.IsParity, mypair.Left.Strand,
-			mypair.Right.Index, mypair.Right.IsParity, mypair.Right.Strand)
+		if ctx.Err() != nil {
+			return nil
+		}
+		l.emit(ctx, Event{Type: EventRepairAttempt, Block: block.ref(),
+			Left: mypair.Left.ref(), Right: mypair.Right.ref()})
 
-		leftChunk, RepairErr := l.getDataFromBlockSequential(mypair.Left, rid, allowDepth-1)
+		l.sequentialRecoverHelper(pairCtx, mypair.Left, rid, allowDepth-1)
+		leftChunk, RepairErr := mypair.Left.GetData()
 		if RepairErr != nil {
 			continue
 		}
 
-		rightChunk, RepairErr := l.getDataFromBlockSequential(mypair.Right, rid, allowDepth-1)
+		l.sequentialRecoverHelper(pairCtx, mypair.Right, rid, allowDepth-1)
+		rightChunk, RepairErr := mypair.Right.GetData()
 		if RepairErr != nil {
 			continue
 		}
 
-		if block.Recover(leftChunk, rightChunk) == nil {
-			return true
+		if l.recoverBlock(ctx, block, mypair, leftChunk, rightChunk) == nil {
+			return mypair
 		}
 	}
-	return false
+	return nil
 }
 
 // sequentialRecoverHelper is a helper function to recursively do the sequential recovery
-func (l *Lattice) sequentialRecoverHelper(block *Block, rid uint, allowDepth uint) {
+func (l *Lattice) sequentialRecoverHelper(ctx context.Context, block *Block, rid uint, allowDepth uint) {
 	var repairSuccess = false
 	var modifyState = true
 	defer func() {
 		if modifyState {
-			block.FinishRepair(repairSuccess)
+			block.FinishRepair(repairSuccess, rid)
 		}
 	}()
 
-	// if already has data or already visited
-	if !block.StartRepair(context.Background(), rid) {
+	if ctx.Err() != nil {
 		modifyState = false
 		return
 	}
-
-	// download data
-	downloadErr := l.downloadBlock(block)
-	if downloadErr == nil {
-		repairSuccess = true
-		printRecoverStatus(false, DownloadSuccess, block)
+	// if already has data, already visited or under repair by another request
+	started, busy := block.TryStartRepair(rid)
+	if !started {
+		if busy {
+			l.addBusyBlock(rid, block)
+		}
+		modifyState = false
 		return
 	}
-	printRecoverStatus(false, DownloadFail, block)
 
-	// repair data
-	success := l.sequentialRepair(block, rid, allowDepth)
-	if success {
-		repairSuccess = true
-		printRecoverStatus(false, RepairSuccess, block)
-	} else {
-		printRecoverStatus(false, RepairFail, block)
-	}
+	// download data, repair it if missing
+	repairSuccess = l.retrieveBlock(ctx, block, rid, false, func(ctx context.Context) *BlockPair {
+		return l.sequentialRepair(ctx, block, rid, allowDepth)
+	})
 }
 
-// parallelRepair repairs a block using muti-threads
-func (l *Lattice) parallelRepair(ctx context.Context, block *Block, rid uint) bool {
+// parallelRepair repairs a block using muti-threads. It returns the pair used, nil if it fails
+func (l *Lattice) parallelRepair(ctx context.Context, block *Block, rid uint) *BlockPair {
 	pairs := block.GetRecoverPairs()
 	if len(pairs) == 0 {
-		return false
+		return nil
 	}
 
-	finish := make(chan bool)
+	// buffered so that the pairs still running after the first success do not leak
+	finish := make(chan *BlockPair, len(pairs))
 	counter := 0
+	pairCtx := deeper(ctx)
 	for _, mypair := range pairs {
-		util.InfoPrintf(util.Yellow("{Parallel} Left - Index: %d, Parity: %t, Strand: %d\n"+
-			"Right - Index: %d, Parity: %t, Strand: %d\n\n"),
-			mypair.Left.Index, mypair.Left.IsParity, mypair.Left.Strand,
-			mypair.Right.Index, mypair.Right.IsParity, mypair.Right.Strand)
+		l.emit(ctx, Event{Type: EventRepairAttempt, Block: block.ref(), Parallel: true,
+			Left: mypair.Left.ref(), Right: mypair.Right.ref()})
 
-		go func(pair *BlockPair) {
+		pair := mypair
+		l.workers.Go(func() {
 			// tell the caller current func is finished
-			success := false
-			defer func() { finish <- success }()
+			var used *BlockPair
+			defer func() { finish <- used }()
 
 			resultChan := make(chan bool, 2)
-			go l.parallelRecoverHelper(ctx, pair.Left, rid, resultChan)
-			go l.parallelRecoverHelper(ctx, pair.Right, rid, resultChan)
+			l.workers.Go(func() { l.parallelRecoverHelper(pairCtx, pair.Left, rid, resultChan) })
+			l.workers.Go(func() { l.parallelRecoverHelper(pairCtx, pair.Right, rid, resultChan) })
 
 			<-resultChan
 			<-resultChan
@@ -302,34 +643,25 @@ func (l *Lattice) parallelRepair(ctx context.Context, block *Block, rid uint) bo
 			if err != nil {
 				return
 			}
-
-			// special case: wrap on itself
-			if pair.Left == pair.Right {
-				block.SetData(leftChunk, true)
-				success = true
-				return
-			}
-
 			rightChunk, err := pair.Right.GetData()
 			if err != nil {
 				return
 			}
 
-			if block.Recover(leftChunk, rightChunk) == nil {
-				success = true
+			if l.recoverBlock(ctx, block, pair, leftChunk, rightChunk) == nil {
+				used = pair
 			}
-		}(mypair)
+		})
 	}
 	// wait until one recover success, or all routine finishes
 	for {
-		success := <-finish
-		if success {
-			return true
+		used := <-finish
+		if used != nil {
+			return used
 		}
 		counter++
 		if counter >= len(pairs) {
-			printRecoverStatus(true, RepairFail, block)
-			return false
+			return nil
 		}
 	}
 }
@@ -340,97 +672,29 @@ func (l *Lattice) parallelRecoverHelper(ctx context.Context, block *Block, rid u
 	var modifyState = true
 	defer func() {
 		if modifyState {
-			block.FinishRepair(repairSuccess)
+			block.FinishRepair(repairSuccess, rid)
 		}
 		channel <- true
 	}()
 
 	select {
 	case <-ctx.Done():
+		modifyState = false
 		return
 	default:
-		// if already has data or already visited
-		if !block.StartRepair(ctx, rid) {
+		// if already has data, already visited or under repair by another request
+		started, busy := block.TryStartRepair(rid)
+		if !started {
+			if busy {
+				l.addBusyBlock(rid, block)
+			}
 			modifyState = false
 			return
 		}
 
-		// download data
-		err := l.downloadBlock(block)
-		if err == nil {
-			repairSuccess = true
-			printRecoverStatus(true, DownloadSuccess, block)
-			return
-		}
-		printRecoverStatus(true, DownloadFail, block)
-
-		// repair data
-		success := l.parallelRepair(ctx, block, rid)
-		if success {
-			repairSuccess = true
-			printRecoverStatus(false, RepairSuccess, block)
-		} else {
-			printRecoverStatus(false, RepairFail, block)
-		}
+		// download data, repair it if missing
+		repairSuccess = l.retrieveBlock(ctx, block, rid, true, func(ctx context.Context) *BlockPair {
+			return l.parallelRepair(ctx, block, rid)
+		})
 	}
 }
-
-// ----------------------------------------------------------------------
-
-// RecoverStatus enums the recover end state of a block
-type RecoverStatus int
-
-const (
-	DataDownloadSuccess RecoverStatus = iota
-	DownloadSuccess
-	DownloadFail
-	RepairSuccess
-	RepairFail
-)
-
-var recoverStatusToString = map[RecoverStatus]string{
-	DownloadSuccess: "downloaded successfully",
-	DownloadFail:    "downloaded fail",
-	RepairSuccess:   "repaired successfully",
-	RepairFail:      "repaired fail",
-}
-
-var recoverStatusToColor = map[RecoverStatus][]func(...interface{}) string{
-	DownloadSuccess: {
-		util.White,
-		util.Magenta,
-	},
-	DownloadFail: {
-		util.Red,
-		util.Red,
-	},
-	RepairSuccess: {
-		util.Green,
-		util.Green,
-	},
-	RepairFail: {
-		util.Red,
-		util.Red,
-	},
-}
-
-// printRecoverStatus prints the log for recover stage
-func printRecoverStatus(isParallel bool, currStage RecoverStatus, block *Block) {
-	var mode string
-	if isParallel {
-		mode = "Parallel"
-	} else {
-		mode = "Sequential"
-	}
-
-	index := 0
-	if block.IsParity {
-		index = 1
-	}
-
-	color := recoverStatusToColor[currStage][index]
-	value := recoverStatusToString[currStage]
-
-	util.LogPrintf(color("{%s} Index: %d, Parity: %t, Strand: %d %s"),
-		mode, block.Index, block.IsParity, block.Strand, value)
-}
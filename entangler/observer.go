@@ -0,0 +1,175 @@
+package entangler
+
+import (
+	"context"
+	"ipfs-alpha-entanglement-code/util"
+	"time"
+)
+
+// EventType enums what happened to a block during the recovery
+type EventType int
+
+const (
+	// EventDownloadStart is sent when the download of a block gets its turn
+	EventDownloadStart EventType = iota
+	// EventDownloadSuccess is sent when a block is downloaded
+	EventDownloadSuccess
+	// EventDownloadFail is sent when the download of a block fails
+	EventDownloadFail
+	// EventDownloadCancel is sent when the download of a block is abandoned, e.g. its repair won
+	EventDownloadCancel
+	// EventHedge is sent when the repair of a block starts because its download is slow
+	EventHedge
+	// EventRepairAttempt is sent when a pair is tried to repair a block
+	EventRepairAttempt
+	// EventRepairSuccess is sent when a block is repaired, with the pair used
+	EventRepairSuccess
+	// EventRepairFail is sent when no pair could repair a block
+	EventRepairFail
+	// EventReject is sent when a downloaded or repaired block fails its integrity check
+	EventReject
+)
+
+var eventTypeNames = map[EventType]string{
+	EventDownloadStart:   "download start",
+	EventDownloadSuccess: "downloaded successfully",
+	EventDownloadFail:    "downloaded fail",
+	EventDownloadCancel:  "download cancelled",
+	EventHedge:           "hedged",
+	EventRepairAttempt:   "repair attempt",
+	EventRepairSuccess:   "repaired successfully",
+	EventRepairFail:      "repaired fail",
+	EventReject:          "rejected",
+}
+
+// String returns the name of the event type
+func (t EventType) String() string {
+	name, ok := eventTypeNames[t]
+	if !ok {
+		return "unknown"
+	}
+	return name
+}
+
+// Event is what happened to a block during the recovery
+type Event struct {
+	Type  EventType
+	Block BlockRef
+	Time  time.Time
+
+	// whether the block is retrieved by the parallel recovery
+	Parallel bool
+	// number of repairs between the requested block and this block. 0 for the requested block
+	Depth int
+	// ID of the request retrieving the block
+	Request uint
+
+	// pair tried or used by a repair
+	Left, Right BlockRef
+
+	// duration of the download or of the repair, once finished
+	Duration time.Duration
+	// size of the downloaded or repaired block
+	Size int
+	Err  error
+}
+
+// Observer receives the events of the recovery. It is called concurrently and must not block
+type Observer interface {
+	Observe(event Event)
+}
+
+// ObserverFunc adapts a function to an Observer
+type ObserverFunc func(event Event)
+
+// Observe calls the function
+func (f ObserverFunc) Observe(event Event) {
+	f(event)
+}
+
+// MultiObserver forwards the events to every observer
+func MultiObserver(observers ...Observer) Observer {
+	return ObserverFunc(func(event Event) {
+		for _, observer := range observers {
+			if observer != nil {
+				observer.Observe(event)
+			}
+		}
+	})
+}
+
+// LogObserver writes the recovery to the logger, the default logger if nil
+type LogObserver struct {
+	Logger *util.Logger
+}
+
+// Observe writes the event with the block as fields
+func (o LogObserver) Observe(event Event) {
+	logger := o.Logger
+	if logger == nil {
+		logger = util.Default()
+	}
+	if !logger.Enabled(util.LevelWarn) {
+		return
+	}
+	mode := "sequential"
+	if event.Parallel {
+		mode = "parallel"
+	}
+	block := event.Block
+	logger = logger.With("index", block.Index, "parity", block.Parity, "strand", block.Strand,
+		"mode", mode, "depth", event.Depth, "request", event.Request)
+
+	switch event.Type {
+	case EventDownloadStart, EventDownloadCancel:
+		logger.Debug("Block " + event.Type.String())
+	case EventDownloadSuccess:
+		logger.Info("Block "+event.Type.String(), "size", event.Size, "duration", event.Duration)
+	case EventDownloadFail:
+		logger.Warn("Block "+event.Type.String(), "duration", event.Duration, "err", event.Err)
+	case EventHedge:
+		logger.Info("Download is slow, start repair", "duration", event.Duration)
+	case EventRepairAttempt:
+		logger.Debug("Try recovery pair", "left", event.Left, "right", event.Right)
+	case EventRepairSuccess:
+		logger.Info("Block "+event.Type.String(), "left", event.Left, "right", event.Right,
+			"size", event.Size, "duration", event.Duration)
+	case EventRepairFail:
+		logger.Warn("Block "+event.Type.String(), "duration", event.Duration)
+	case EventReject:
+		logger.Warn("Reject block", "err", event.Err)
+	}
+}
+
+// emit sends the event to the observer of the lattice
+func (l *Lattice) emit(ctx context.Context, event Event) {
+	if l.Observer == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	event.Depth = depthOf(ctx)
+	event.Request, _ = ctx.Value(requestKey{}).(uint)
+	l.Observer.Observe(event)
+}
+
+type requestKey struct{}
+
+// withRequest returns the context of the retrieval of a block by the request
+func withRequest(ctx context.Context, rid uint) context.Context {
+	return context.WithValue(ctx, requestKey{}, rid)
+}
+
+type depthKey struct{}
+
+// deeper returns the context of the blocks used to repair the block of the context
+func deeper(ctx context.Context) context.Context {
+	return context.WithValue(ctx, depthKey{}, depthOf(ctx)+1)
+}
+
+// depthOf returns the recovery depth of the block retrieved under the context
+func depthOf(ctx context.Context) int {
+	depth, _ := ctx.Value(depthKey{}).(int)
+	return depth
+}
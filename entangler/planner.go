@@ -0,0 +1,336 @@
+package entangler
+
+import (
+	"container/heap"
+	"fmt"
+	"math"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// BlockRef identifies a data block, or a parity block on its strand
+type BlockRef struct {
+	Index  int
+	Parity bool
+	Strand int `json:",omitempty"`
+}
+
+// String returns a readable name of the block
+func (r BlockRef) String() string {
+	if r.Parity {
+		return fmt.Sprintf("parity %d (strand %d)", r.Index, r.Strand)
+	}
+	return fmt.Sprintf("data %d", r.Index)
+}
+
+// ref returns the reference of the block
+func (b *Block) ref() BlockRef {
+	return BlockRef{Index: b.Index, Parity: b.IsParity, Strand: b.Strand}
+}
+
+// Availability tells which blocks can be fetched directly, without fetching them
+type Availability interface {
+	// Probe returns whether the block can be fetched, with its estimated size (0 if unknown)
+	// and the estimated latency of its download
+	Probe(ref BlockRef) (available bool, size int, latency time.Duration)
+}
+
+// CostModel is what the planner minimizes
+type CostModel int
+
+const (
+	// CostBlocks minimizes the number of fetched blocks
+	CostBlocks CostModel = iota
+	// CostBytes minimizes the number of fetched bytes
+	CostBytes
+	// CostLatency minimizes the sum of the estimated download latencies
+	CostLatency
+)
+
+var costModelNames = map[CostModel]string{
+	CostBlocks:  "blocks",
+	CostBytes:   "bytes",
+	CostLatency: "latency",
+}
+
+// String returns the name of the cost model
+func (m CostModel) String() string {
+	name, ok := costModelNames[m]
+	if !ok {
+		return "unknown"
+	}
+	return name
+}
+
+// ParseCostModel returns the cost model with the given name
+func ParseCostModel(name string) (CostModel, error) {
+	for model, modelName := range costModelNames {
+		if modelName == name {
+			return model, nil
+		}
+	}
+	return CostBlocks, xerrors.Errorf("invalid cost model %q: expected blocks, bytes or latency", name)
+}
+
+// DefaultBlockSize is the size assumed for the blocks whose size is unknown
+var DefaultBlockSize = 256 * 1024
+
+// PlanFetch is a block downloaded by the plan
+type PlanFetch struct {
+	Block   BlockRef
+	Size    int
+	Latency time.Duration
+}
+
+// PlanRepair is a block rebuilt from a pair of blocks
+type PlanRepair struct {
+	Target BlockRef
+	Left   BlockRef
+	Right  BlockRef
+}
+
+// RecoveryPlan is the cheapest set of fetches found to rebuild the requested chunks.
+// The repairs are ordered so that every repair comes after the ones it depends on
+type RecoveryPlan struct {
+	Model         CostModel
+	Fetches       []PlanFetch
+	Repairs       []PlanRepair
+	Unrecoverable []int
+	Cost          float64
+	Bytes         int64
+}
+
+// planNode is the state of a block during planning
+type planNode struct {
+	block     *Block
+	probed    bool
+	available bool
+	size      int
+	latency   time.Duration
+
+	planned   bool
+	cost      float64
+	final     bool
+	via       *BlockPair
+	dependent []*planNode
+	heapIndex int
+}
+
+// planner computes the cheapest derivation of every block with Knuth's generalization of
+// Dijkstra's algorithm: an unavailable block costs the cheapest sum of the costs of one of
+// its recovery pairs. Only the blocks reachable through unavailable blocks are probed.
+// Finding the cheapest union of derivations is NP-hard, the lost chunks are thus planned
+// greedily one after the other
+type planner struct {
+	availability Availability
+	model        CostModel
+	nodes        map[*Block]*planNode
+}
+
+// Plan computes the cheapest set of block fetches rebuilding the indexed data chunks, given the
+// availability of the blocks. Nothing is fetched. Blocks shared by several repairs are fetched once
+func (l *Lattice) Plan(indexes []int, availability Availability, model CostModel) (*RecoveryPlan, error) {
+	p := &planner{availability: availability, model: model, nodes: map[*Block]*planNode{}}
+
+	targets := make([]*planNode, len(indexes))
+	for i, index := range indexes {
+		block, err := l.getBlock(index)
+		if err != nil {
+			return nil, err
+		}
+		targets[i] = p.node(block)
+	}
+	p.explore(targets)
+
+	plan := &RecoveryPlan{Model: model}
+	var add func(n *planNode)
+	add = func(n *planNode) {
+		if n.planned {
+			return
+		}
+		n.planned = true
+		if n.via == nil {
+			plan.Fetches = append(plan.Fetches, PlanFetch{Block: n.block.ref(), Size: n.size, Latency: n.latency})
+			plan.Cost += p.fetchCost(n)
+			plan.Bytes += int64(p.size(n))
+			return
+		}
+		add(p.nodes[n.via.Left])
+		add(p.nodes[n.via.Right])
+		plan.Repairs = append(plan.Repairs, PlanRepair{
+			Target: n.block.ref(),
+			Left:   n.via.Left.ref(),
+			Right:  n.via.Right.ref(),
+		})
+	}
+
+	// the available chunks are fetched anyway
+	for _, target := range targets {
+		if target.available {
+			add(target)
+		}
+	}
+	// the lost chunks are planned one after the other, reusing the blocks already planned for free
+	for i, target := range targets {
+		if target.planned {
+			continue
+		}
+		p.solve()
+		if math.IsInf(target.cost, 1) {
+			plan.Unrecoverable = append(plan.Unrecoverable, indexes[i])
+			continue
+		}
+		add(target)
+	}
+
+	return plan, nil
+}
+
+// node returns the planning state of the block
+func (p *planner) node(block *Block) *planNode {
+	n, ok := p.nodes[block]
+	if !ok {
+		n = &planNode{block: block, heapIndex: -1}
+		p.nodes[block] = n
+	}
+	return n
+}
+
+// probe asks the availability of the block once
+func (p *planner) probe(n *planNode) {
+	if n.probed {
+		return
+	}
+	n.probed = true
+	n.available, n.size, n.latency = p.availability.Probe(n.block.ref())
+}
+
+// explore probes the targets and every block reachable from them through unavailable blocks,
+// and links every pair to the block it can rebuild
+func (p *planner) explore(targets []*planNode) {
+	queue := append([]*planNode{}, targets...)
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		if n.probed {
+			continue
+		}
+		p.probe(n)
+		if n.available {
+			continue
+		}
+		for _, pair := range n.block.GetRecoverPairs() {
+			for _, side := range []*Block{pair.Left, pair.Right} {
+				sideNode := p.node(side)
+				sideNode.dependent = append(sideNode.dependent, n)
+				if !sideNode.probed {
+					queue = append(queue, sideNode)
+				}
+			}
+		}
+	}
+}
+
+// solve computes the cheapest derivation of every block. The blocks already planned are free,
+// the available ones cost their download. The blocks are finalized from the cheapest one,
+// relaxing the blocks they can rebuild
+func (p *planner) solve() {
+	queue := &planQueue{}
+	for _, n := range p.nodes {
+		n.final = false
+		n.heapIndex = -1
+		if n.planned {
+			n.cost = 0
+		} else {
+			n.cost = math.Inf(1)
+			n.via = nil
+			if n.available {
+				n.cost = p.fetchCost(n)
+			}
+		}
+		if !math.IsInf(n.cost, 1) {
+			heap.Push(queue, n)
+		}
+	}
+	for queue.Len() > 0 {
+		n := heap.Pop(queue).(*planNode)
+		n.final = true
+		for _, dependent := range n.dependent {
+			if dependent.final {
+				continue
+			}
+			for _, pair := range dependent.block.GetRecoverPairs() {
+				cost, ok := p.pairCost(pair)
+				if !ok || cost >= dependent.cost {
+					continue
+				}
+				dependent.cost = cost
+				dependent.via = pair
+				if dependent.heapIndex < 0 {
+					heap.Push(queue, dependent)
+				} else {
+					heap.Fix(queue, dependent.heapIndex)
+				}
+			}
+		}
+	}
+}
+
+// pairCost returns the cost of a pair if both its blocks are finalized
+func (p *planner) pairCost(pair *BlockPair) (float64, bool) {
+	left, right := p.nodes[pair.Left], p.nodes[pair.Right]
+	if left == nil || right == nil || !left.final || !right.final {
+		return 0, false
+	}
+	if left == right {
+		// wrap on itself
+		return left.cost, true
+	}
+	return left.cost + right.cost, true
+}
+
+// size returns the known or assumed size of the block
+func (p *planner) size(n *planNode) int {
+	if n.size > 0 {
+		return n.size
+	}
+	return DefaultBlockSize
+}
+
+// fetchCost returns the cost of downloading the block under the cost model
+func (p *planner) fetchCost(n *planNode) float64 {
+	switch p.model {
+	case CostBytes:
+		return float64(p.size(n))
+	case CostLatency:
+		return n.latency.Seconds()
+	}
+	return 1
+}
+
+// planQueue is a priority queue of blocks by cost
+type planQueue []*planNode
+
+func (q planQueue) Len() int           { return len(q) }
+func (q planQueue) Less(i, j int) bool { return q[i].cost < q[j].cost }
+func (q planQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].heapIndex = i
+	q[j].heapIndex = j
+}
+
+func (q *planQueue) Push(x interface{}) {
+	n := x.(*planNode)
+	n.heapIndex = len(*q)
+	*q = append(*q, n)
+}
+
+func (q *planQueue) Pop() interface{} {
+	old := *q
+	n := old[len(old)-1]
+	old[len(old)-1] = nil
+	n.heapIndex = -1
+	*q = old[:len(old)-1]
+	return n
+}
@@ -0,0 +1,140 @@
+package entangler
+
+import (
+	"context"
+	"sync"
+)
+
+var (
+	// DefaultRecoveryWorkers bounds the goroutines spawned by the parallel recovery of a lattice
+	DefaultRecoveryWorkers = 64
+	// DefaultMaxDownloads bounds the concurrent block downloads of a lattice
+	DefaultMaxDownloads = 16
+)
+
+// workerPool bounds the number of goroutines. A task runs inline in the caller when the pool is
+// exhausted, so that recursive tasks waiting for their children can never deadlock
+type workerPool struct {
+	slots chan struct{}
+}
+
+// newWorkerPool creates a pool of the given size
+func newWorkerPool(size int) *workerPool {
+	if size < 1 {
+		size = 1
+	}
+	return &workerPool{slots: make(chan struct{}, size)}
+}
+
+// Go runs the task in a new goroutine if a slot is free, otherwise in the caller
+func (p *workerPool) Go(task func()) {
+	select {
+	case p.slots <- struct{}{}:
+		go func() {
+			defer func() { <-p.slots }()
+			task()
+		}()
+	default:
+		task()
+	}
+}
+
+// scheduler bounds the number of concurrent downloads and shares them fairly between the
+// top-level requests: the waiting downloads are served round-robin, one request after the other,
+// so that a request repairing a large part of the lattice does not starve the others
+type scheduler struct {
+	*sync.Mutex
+
+	capacity int
+	running  int
+	waiting  map[uint][]chan struct{}
+	order    []uint
+}
+
+// newScheduler creates a scheduler allowing the given number of concurrent downloads
+func newScheduler(capacity int) *scheduler {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &scheduler{
+		Mutex:    &sync.Mutex{},
+		capacity: capacity,
+		waiting:  map[uint][]chan struct{}{},
+	}
+}
+
+// Acquire waits for the turn of the request to download a block
+func (s *scheduler) Acquire(ctx context.Context, rid uint) error {
+	s.Lock()
+	if s.running < s.capacity && len(s.order) == 0 {
+		s.running++
+		s.Unlock()
+		return nil
+	}
+	turn := make(chan struct{})
+	if _, ok := s.waiting[rid]; !ok {
+		s.order = append(s.order, rid)
+	}
+	s.waiting[rid] = append(s.waiting[rid], turn)
+	s.Unlock()
+
+	select {
+	case <-turn:
+		return nil
+	case <-ctx.Done():
+		s.Lock()
+		granted := !s.dequeue(rid, turn)
+		s.Unlock()
+		if granted {
+			// the turn was given while cancelling
+			s.Release()
+		}
+		return ctx.Err()
+	}
+}
+
+// Release ends a download and gives the turn to the next request
+func (s *scheduler) Release() {
+	s.Lock()
+	defer s.Unlock()
+
+	if len(s.order) == 0 {
+		s.running--
+		return
+	}
+	rid := s.order[0]
+	queue := s.waiting[rid]
+	turn := queue[0]
+	if len(queue) == 1 {
+		delete(s.waiting, rid)
+		s.order = s.order[1:]
+	} else {
+		s.waiting[rid] = queue[1:]
+		s.order = append(s.order[1:], rid)
+	}
+	close(turn)
+}
+
+// dequeue removes a waiting download and returns whether it was still waiting
+func (s *scheduler) dequeue(rid uint, turn chan struct{}) bool {
+	queue := s.waiting[rid]
+	for i, waiting := range queue {
+		if waiting != turn {
+			continue
+		}
+		queue = append(queue[:i], queue[i+1:]...)
+		if len(queue) > 0 {
+			s.waiting[rid] = queue
+			return true
+		}
+		delete(s.waiting, rid)
+		for j, id := range s.order {
+			if id == rid {
+				s.order = append(s.order[:j], s.order[j+1:]...)
+				break
+			}
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,174 @@
+package entangler
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// RecoveryStrategy selects how the lattice recovers a missing block
+type RecoveryStrategy int
+
+const (
+	// HybridStrategy tries the sequential recovery up to SwitchDepth, then the parallel one
+	HybridStrategy RecoveryStrategy = iota
+	// SequentialStrategy only uses the sequential recovery up to SwitchDepth
+	SequentialStrategy
+	// ParallelStrategy directly uses the parallel recovery
+	ParallelStrategy
+	// AdaptiveStrategy escalates the depth of the sequential recovery step by step, up to a depth
+	// tuned from the observed loss rate and block latency, then switches to the parallel recovery
+	AdaptiveStrategy
+)
+
+var recoveryStrategyNames = map[RecoveryStrategy]string{
+	HybridStrategy:     "hybrid",
+	SequentialStrategy: "sequential",
+	ParallelStrategy:   "parallel",
+	AdaptiveStrategy:   "adaptive",
+}
+
+// String returns the name of the strategy
+func (s RecoveryStrategy) String() string {
+	name, ok := recoveryStrategyNames[s]
+	if !ok {
+		return "unknown"
+	}
+	return name
+}
+
+// ParseRecoveryStrategy returns the strategy with the given name
+func ParseRecoveryStrategy(name string) (RecoveryStrategy, error) {
+	for strategy, strategyName := range recoveryStrategyNames {
+		if strategyName == name {
+			return strategy, nil
+		}
+	}
+	return HybridStrategy, xerrors.Errorf("invalid recovery strategy %q: expected hybrid, sequential, parallel or adaptive", name)
+}
+
+var (
+	// AdaptiveMaxDepth is the deepest sequential attempt of the adaptive strategy when nothing is lost
+	AdaptiveMaxDepth uint = 4
+	// AdaptiveParallelLoss is the loss rate from which the adaptive strategy directly goes parallel
+	AdaptiveParallelLoss = 0.5
+	// AdaptiveSlowLatency is the block latency from which sequential round trips are considered too
+	// expensive, and the adaptive strategy only tries one step before going parallel
+	AdaptiveSlowLatency = 500 * time.Millisecond
+)
+
+// RecoveryStats are the download statistics observed by the lattice
+type RecoveryStats struct {
+	Downloads int
+	Failures  int
+	// smoothed latency of the successful downloads
+	Latency time.Duration
+}
+
+// LossRate returns the ratio of failed downloads
+func (s RecoveryStats) LossRate() float64 {
+	if s.Downloads == 0 {
+		return 0
+	}
+	return float64(s.Failures) / float64(s.Downloads)
+}
+
+// recoveryStats collects the statistics concurrently
+type recoveryStats struct {
+	sync.Mutex
+	RecoveryStats
+}
+
+// observe records the result of a download
+func (s *recoveryStats) observe(latency time.Duration, err error) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.Downloads++
+	if err != nil {
+		s.Failures++
+		return
+	}
+	if s.Downloads-s.Failures == 1 {
+		s.Latency = latency
+	} else {
+		s.Latency = (7*s.Latency + latency) / 8
+	}
+}
+
+// snapshot returns the current statistics
+func (s *recoveryStats) snapshot() RecoveryStats {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.RecoveryStats
+}
+
+// Stats returns the download statistics observed so far
+func (l *Lattice) Stats() RecoveryStats {
+	return l.stats.snapshot()
+}
+
+// adaptiveDepth returns how deep the adaptive strategy escalates the sequential recovery
+// before switching to the parallel one
+func (l *Lattice) adaptiveDepth() uint {
+	stats := l.stats.snapshot()
+	loss := stats.LossRate()
+	if loss >= AdaptiveParallelLoss {
+		return 0
+	}
+
+	// the more blocks are lost, the less likely a shallow sequential recovery succeeds
+	depth := uint(float64(AdaptiveMaxDepth)*(1-loss/AdaptiveParallelLoss) + 0.5)
+	if depth == 0 {
+		depth = 1
+	}
+	if stats.Latency >= AdaptiveSlowLatency {
+		depth = 1
+	}
+	return depth
+}
+
+// missingBlocks are the blocks whose download failed during the steps of an adaptive recovery,
+// so that the deeper steps repair them without downloading them again
+type missingBlocks struct {
+	sync.Mutex
+	blocks map[*Block]bool
+}
+
+type missingKey struct{}
+
+// withMissingBlocks returns the context of a recovery remembering the missing blocks across its steps
+func withMissingBlocks(ctx context.Context) context.Context {
+	return context.WithValue(ctx, missingKey{}, &missingBlocks{blocks: make(map[*Block]bool)})
+}
+
+// missingOf returns the missing blocks remembered under the context, nil if they are not remembered
+func missingOf(ctx context.Context) *missingBlocks {
+	missing, _ := ctx.Value(missingKey{}).(*missingBlocks)
+	return missing
+}
+
+// add remembers that the download of the block failed
+func (m *missingBlocks) add(block *Block) {
+	if m == nil {
+		return
+	}
+	m.Lock()
+	defer m.Unlock()
+
+	m.blocks[block] = true
+}
+
+// has returns whether the download of the block already failed
+func (m *missingBlocks) has(block *Block) bool {
+	if m == nil {
+		return false
+	}
+	m.Lock()
+	defer m.Unlock()
+
+	return m.blocks[block]
+}
@@ -0,0 +1,214 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"ipfs-alpha-entanglement-code/client"
+	"ipfs-alpha-entanglement-code/util"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// PathPrefix is the path prefix of the files served by the gateway, as on an IPFS gateway
+const PathPrefix = "/ipfs/"
+
+// DefaultAddr is the address of the gateway when none is given
+var DefaultAddr = "127.0.0.1:8080"
+
+// DefaultCacheSize is the number of entangled files kept open when none is given
+var DefaultCacheSize = 16
+
+// metadataPrefix starts every encoded metadata, it tells a metadata CID from a file CID
+var metadataPrefix = []byte(`{"Alpha":`)
+
+// Option configures the gateway
+type Option struct {
+	// Resolve finds the metadata CID of a file CID before the client looks for it in the cluster.
+	// The files whose metadata is not found are served without recovery
+	Resolve func(rootCID string) (metaCID string, ok bool)
+
+	// number of entangled files kept open with their lattice. 0 uses DefaultCacheSize
+	CacheSize int
+
+	// recovery of the missing blocks. The range and the progress are set by the requests
+	Download client.DownloadOption
+}
+
+// Gateway serves files read-only over HTTP at /ipfs/<cid>[/<name>], with range requests.
+// The cid is either the metadata CID of an entangled file or the CID of a file. The missing blocks of an
+// entangled file are repaired through its lattice on the fly. The optional name sets the content type
+type Gateway struct {
+	client *client.Client
+	option Option
+
+	lock  *sync.Mutex
+	files map[string]*client.File
+	order []string
+}
+
+// NewGateway creates a gateway reading the files through the client
+func NewGateway(c *client.Client, option Option) *Gateway {
+	if option.CacheSize <= 0 {
+		option.CacheSize = DefaultCacheSize
+	}
+	option.Download.Range = nil
+	option.Download.Partial = false
+	option.Download.Progress = nil
+	return &Gateway{
+		client: c,
+		option: option,
+		lock:   &sync.Mutex{},
+		files:  make(map[string]*client.File),
+	}
+}
+
+// ServeHTTP serves the file of the path. It implements http.Handler
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	cid, name, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, PathPrefix), "/")
+	if len(cid) == 0 || !strings.HasPrefix(r.URL.Path, PathPrefix) {
+		http.Error(w, "expected "+PathPrefix+"<cid>", http.StatusNotFound)
+		return
+	}
+	err := g.client.InitIPFSConnector()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	ref := g.resolve(r.Context(), cid, r.URL.Query().Get("metacid"))
+	content := &seekableStream{ctx: r.Context()}
+	defer content.Close()
+	if len(ref.MetaCID) > 0 {
+		file, err := g.open(ref)
+		if err != nil {
+			g.fail(w, cid, err)
+			return
+		}
+		ref.RootCID = file.RootCID()
+		content.size = file.Size()
+		content.stream = func(ctx context.Context, w io.Writer, offset int64) error {
+			return file.WriteRange(ctx, w, offset, -1)
+		}
+	} else {
+		content.size, err = g.client.FileSize(r.Context(), ref.RootCID)
+		if err != nil {
+			g.fail(w, cid, err)
+			return
+		}
+		content.stream = func(ctx context.Context, w io.Writer, offset int64) error {
+			// the file has no known metadata, it is read without recovery
+			return g.client.GetFileRangeToWriter(ref.RootCID, offset, -1, w)
+		}
+	}
+
+	// the content of a CID never changes
+	w.Header().Set("Etag", `"`+ref.RootCID+`"`)
+	w.Header().Set("Cache-Control", "public, max-age=29030400, immutable")
+	w.Header().Set("X-Ipfs-Path", PathPrefix+ref.RootCID)
+	if len(ref.MetaCID) > 0 {
+		w.Header().Set("X-Entangler-Metacid", ref.MetaCID)
+	}
+	http.ServeContent(w, r, name, time.Time{}, content)
+}
+
+// resolve finds the reference of the CID of the path: a metadata CID given with the query, found by
+// the resolver or discovered by the client from the file CID, or the CID itself if it holds metadata.
+// The metadata is looked for before the CID is read, since the first block of a file may be missing
+func (g *Gateway) resolve(ctx context.Context, cid string, metaCID string) client.Ref {
+	if len(metaCID) > 0 {
+		return client.Ref{RootCID: cid, MetaCID: metaCID}
+	}
+	if g.option.Resolve != nil {
+		if metaCID, ok := g.option.Resolve(cid); ok {
+			return client.Ref{RootCID: cid, MetaCID: metaCID}
+		}
+	}
+
+	g.lock.Lock()
+	_, ok := g.files[cid]
+	g.lock.Unlock()
+	if ok {
+		return client.Ref{MetaCID: cid}
+	}
+	metaCID, err := g.client.FindMetaCID(ctx, cid)
+	if err == nil {
+		return client.Ref{RootCID: cid, MetaCID: metaCID}
+	}
+	if !errors.Is(err, client.ErrMetadataNotFound) {
+		g.client.Logger.Debug("Fail to find the metadata", "cid", cid, "err", err)
+	}
+
+	// a CID that cannot be read is not metadata, it is served without recovery
+	prefix, err := g.client.GetFileRangeToMemContext(ctx, cid, 0, len(metadataPrefix))
+	if err == nil && bytes.Equal(prefix, metadataPrefix) {
+		return client.Ref{MetaCID: cid}
+	}
+	return client.Ref{RootCID: cid}
+}
+
+// open returns the entangled file of the metadata, opened once and kept in the cache.
+// The file must be the one of the reference, whether it is cached or not
+func (g *Gateway) open(ref client.Ref) (*client.File, error) {
+	g.lock.Lock()
+	file, ok := g.files[ref.MetaCID]
+	g.lock.Unlock()
+	if !ok {
+		opened, err := g.client.OpenFile(ref, g.option.Download)
+		if err != nil {
+			return nil, err
+		}
+		file = g.keep(ref.MetaCID, opened)
+	}
+	if len(ref.RootCID) > 0 && ref.RootCID != file.RootCID() {
+		return nil, xerrors.Errorf("metadata %s describes file %s, not %s: %w",
+			ref.MetaCID, file.RootCID(), ref.RootCID, client.ErrInvalidParameters)
+	}
+
+	return file, nil
+}
+
+// keep caches the file of the metadata, and returns the file already cached if any
+func (g *Gateway) keep(metaCID string, file *client.File) *client.File {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if cached, ok := g.files[metaCID]; ok {
+		return cached
+	}
+	if len(g.order) >= g.option.CacheSize {
+		delete(g.files, g.order[0])
+		g.order = g.order[1:]
+	}
+	g.files[metaCID] = file
+	g.order = append(g.order, metaCID)
+	return file
+}
+
+// fail replies the error: a bad request for invalid references, a bad gateway otherwise
+func (g *Gateway) fail(w http.ResponseWriter, cid string, err error) {
+	code := http.StatusBadGateway
+	if errors.Is(err, client.ErrInvalidParameters) || errors.Is(err, client.ErrMetadataCorrupt) {
+		code = http.StatusBadRequest
+	}
+	g.client.Logger.Warn("Fail to serve file", "cid", cid, "err", err)
+	http.Error(w, err.Error(), code)
+}
+
+// Serve serves the gateway at the address until the context is done
+func (g *Gateway) Serve(ctx context.Context, addr string) error {
+	if len(addr) == 0 {
+		addr = DefaultAddr
+	}
+	g.client.Logger.Info("Gateway is listening", "addr", addr)
+	return util.ListenAndServe(ctx, &http.Server{Addr: addr, Handler: g})
+}
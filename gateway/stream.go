@@ -0,0 +1,68 @@
+package gateway
+
+import (
+	"context"
+	"io"
+
+	"golang.org/x/xerrors"
+)
+
+// seekableStream reads a file streamed from an offset to its end. A seek to another offset restarts the
+// stream, so the consecutive reads of http.ServeContent walk the DAG of the file only once
+type seekableStream struct {
+	ctx    context.Context
+	stream func(ctx context.Context, w io.Writer, offset int64) error
+	size   int64
+
+	offset int64
+	reader *io.PipeReader
+	cancel context.CancelFunc
+}
+
+// Read reads the stream, started at the current offset on first read
+func (s *seekableStream) Read(p []byte) (int, error) {
+	if s.offset >= s.size {
+		return 0, io.EOF
+	}
+	if s.reader == nil {
+		ctx, cancel := context.WithCancel(s.ctx)
+		reader, writer := io.Pipe()
+		go func(offset int64) {
+			writer.CloseWithError(s.stream(ctx, writer, offset))
+		}(s.offset)
+		s.reader, s.cancel = reader, cancel
+	}
+
+	n, err := s.reader.Read(p)
+	s.offset += int64(n)
+	return n, err
+}
+
+// Seek moves the offset of the next read. It implements io.Seeker
+func (s *seekableStream) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += s.offset
+	case io.SeekEnd:
+		offset += s.size
+	}
+	if offset < 0 {
+		return 0, xerrors.Errorf("negative offset %d", offset)
+	}
+	if offset != s.offset {
+		s.Close()
+		s.offset = offset
+	}
+	return offset, nil
+}
+
+// Close stops the running stream
+func (s *seekableStream) Close() error {
+	if s.reader == nil {
+		return nil
+	}
+	s.cancel()
+	err := s.reader.Close()
+	s.reader = nil
+	return err
+}
@@ -3,18 +3,31 @@ package ipfscluster
 import (
 	"encoding/json"
 	"fmt"
+	"ipfs-alpha-entanglement-code/util"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
+	"sync"
+
+	"golang.org/x/xerrors"
 )
 
 var DefaultPort = 9094
 
+// ErrUnexpectedResponse is returned when the cluster replies with a malformed or incomplete answer
+var ErrUnexpectedResponse = xerrors.New("unexpected response from IPFS cluster")
+
 type Connector struct {
 	url        string
 	selfID     string
 	peerIDs    []string
 	currentIdx int
+
+	// protects currentIdx when pinning concurrently
+	lock sync.Mutex
+
+	Logger *util.Logger
 }
 
 // CreateIPFSClusterConnector is the constructor of IPFSClusterConnector
@@ -22,7 +35,7 @@ func CreateIPFSClusterConnector(port int) (*Connector, error) {
 	if port == 0 {
 		port = DefaultPort
 	}
-	conn := Connector{url: fmt.Sprintf("http://127.0.0.1:%d", port)}
+	conn := Connector{url: fmt.Sprintf("http://127.0.0.1:%d", port), Logger: util.Default()}
 	_, err := conn.PeerInfo()
 	if err != nil {
 		return nil, err
@@ -47,18 +60,18 @@ func (c *Connector) PeerInfo() (string, error) {
 	decoder := json.NewDecoder(resp.Body)
 	var info map[string]interface{}
 	if err = decoder.Decode(&info); err != nil {
-		panic(err)
+		return "", xerrors.Errorf("fail to decode peer info: %s: %w", err, ErrUnexpectedResponse)
 	}
 
 	selfID, ok := info["id"].(string)
 	if !ok {
-		panic("ID field does not exist!")
+		return "", xerrors.Errorf("ID field does not exist: %w", ErrUnexpectedResponse)
 	}
 	c.selfID = selfID
 
 	selfName, ok := info["peername"].(string)
 	if !ok {
-		panic("peername field does not exist!")
+		return "", xerrors.Errorf("peername field does not exist: %w", ErrUnexpectedResponse)
 	}
 	return selfName, nil
 }
@@ -74,18 +87,28 @@ func (c *Connector) PeerLs() (int, error) {
 	defer resp.Body.Close()
 
 	var peersInfo []map[string]interface{}
+	var peerIDs []string
 	decoder := json.NewDecoder(resp.Body)
 	for decoder.More() {
 		var info map[string]interface{}
 		if err = decoder.Decode(&info); err != nil {
-			panic(err)
+			return 0, xerrors.Errorf("fail to decode peer list: %s: %w", err, ErrUnexpectedResponse)
 		}
 		peersInfo = append(peersInfo, info)
-		if info["id"].(string) != c.selfID {
-			c.peerIDs = append(c.peerIDs, info["id"].(string))
+		peerID, ok := info["id"].(string)
+		if !ok {
+			return 0, xerrors.Errorf("ID field does not exist: %w", ErrUnexpectedResponse)
+		}
+		if peerID != c.selfID {
+			peerIDs = append(peerIDs, peerID)
 		}
 	}
 
+	c.lock.Lock()
+	c.peerIDs = peerIDs
+	c.currentIdx = 0
+	c.lock.Unlock()
+
 	return len(peersInfo), nil
 }
 
@@ -113,43 +136,146 @@ func (c *Connector) PinStatus(cid string) (string, error) {
 	for decoder.More() {
 		var status map[string]interface{}
 		if err = decoder.Decode(&status); err != nil {
-			panic(err)
+			return "", xerrors.Errorf("fail to decode pin status: %s: %w", err, ErrUnexpectedResponse)
 		}
 		pinInfo = append(pinInfo, status)
 	}
 
 	for _, status := range pinInfo {
-		var statusMap = status["peer_map"].(map[string]interface{})
+		pinCID, ok := status["cid"].(string)
+		if !ok {
+			return "", xerrors.Errorf("cid field does not exist: %w", ErrUnexpectedResponse)
+		}
+		peerStatus, err := peerPinStatus(status)
+		if err != nil {
+			return "", err
+		}
 		var pinCount int
-		for key := range statusMap {
-			if statusMap[key].(map[string]interface{})["status"].(string) == "pinned" {
+		for _, s := range peerStatus {
+			if s == "pinned" {
 				pinCount++
 			}
 		}
-		pinStatus += fmt.Sprintf("%s pinned by %d peers.\n", status["cid"].(string), pinCount)
+		pinStatus += fmt.Sprintf("%s pinned by %d peers.\n", pinCID, pinCount)
 	}
 	pinStatus = fmt.Sprintf("\nTotal number of pins: %d\n", len(pinInfo)) + pinStatus
 
-	return pinStatus, err
+	return pinStatus, nil
+}
+
+// PinPeers returns the number of cluster peers holding the pin of the CID. A CID unknown to the cluster
+// is held by no peer
+func (c *Connector) PinPeers(cid string) (int, error) {
+	resp, err := http.Get(c.url + "/pins/" + cid)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return 0, nil
+	}
+
+	var status map[string]interface{}
+	err = json.NewDecoder(resp.Body).Decode(&status)
+	if err != nil {
+		return 0, xerrors.Errorf("fail to decode pin status: %s: %w", err, ErrUnexpectedResponse)
+	}
+	peerStatus, err := peerPinStatus(status)
+	if err != nil {
+		return 0, err
+	}
+	var pinCount int
+	for _, s := range peerStatus {
+		if s == "pinned" {
+			pinCount++
+		}
+	}
+	return pinCount, nil
+}
+
+// peerPinStatus returns the pin status of a CID on each peer
+func peerPinStatus(status map[string]interface{}) (map[string]string, error) {
+	statusMap, ok := status["peer_map"].(map[string]interface{})
+	if !ok {
+		return nil, xerrors.Errorf("peer_map field does not exist: %w", ErrUnexpectedResponse)
+	}
+	peerStatus := make(map[string]string, len(statusMap))
+	for key, value := range statusMap {
+		info, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, xerrors.Errorf("invalid status of peer %s: %w", key, ErrUnexpectedResponse)
+		}
+		s, ok := info["status"].(string)
+		if !ok {
+			return nil, xerrors.Errorf("status field does not exist: %w", ErrUnexpectedResponse)
+		}
+		peerStatus[key] = s
+	}
+	return peerStatus, nil
 }
 
 // AddPin add the specified CID to the ipfs cluster, with the specified replication factor,
 // the default behavior is recursive, which means pinning all content that is beneath the CID
 // "mode" can be "direct" or "recursive"
 func (c *Connector) AddPin(cid string, replicationFactor int) error {
+	return c.AddNamedPin(cid, "", replicationFactor)
+}
+
+// AddNamedPin adds the CID to the cluster like AddPin, under a name by which FindPins finds it
+func (c *Connector) AddNamedPin(cid string, name string, replicationFactor int) error {
 	/* Add a new CID to the cluster,  it uses the default replication
 	factor that is specified in the CLUSTER configuration file */
+	c.lock.Lock()
+	if len(c.peerIDs) == 0 {
+		c.lock.Unlock()
+		return xerrors.Errorf("no other peer in the cluster to pin %s", cid)
+	}
 	peerID := c.peerIDs[c.currentIdx]
 	c.currentIdx = (c.currentIdx + 1) % len(c.peerIDs)
-	postURL := fmt.Sprintf("%s/pins/ipfs/%s?mode=recursive&name=&replication-max="+
+	c.lock.Unlock()
+	postURL := fmt.Sprintf("%s/pins/ipfs/%s?mode=recursive&name=%s&replication-max="+
 		"%d&replication-min=%d&shard-size=0&user-allocations=%s",
-		c.url, cid, replicationFactor, replicationFactor, peerID)
+		c.url, cid, url.QueryEscape(name), replicationFactor, replicationFactor, peerID)
 	resp, err := http.PostForm(postURL, nil)
 	if err != nil {
 		return err
 	}
 	resp.Body.Close()
-	return err
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return xerrors.Errorf("fail to pin %s: status %d: %w", cid, resp.StatusCode, ErrUnexpectedResponse)
+	}
+	c.Logger.Debug("Pin block", "cid", cid, "name", name, "peer", peerID, "replication", replicationFactor)
+	return nil
+}
+
+// FindPins returns the CIDs pinned in the cluster under the name
+func (c *Connector) FindPins(name string) ([]string, error) {
+	resp, err := http.Get(c.url + "/allocations?filter=pin")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, xerrors.Errorf("fail to list pins: status %d: %w", resp.StatusCode, ErrUnexpectedResponse)
+	}
+
+	cids := make([]string, 0)
+	decoder := json.NewDecoder(resp.Body)
+	for decoder.More() {
+		var pin map[string]interface{}
+		if err = decoder.Decode(&pin); err != nil {
+			return nil, xerrors.Errorf("fail to decode pin list: %s: %w", err, ErrUnexpectedResponse)
+		}
+		if pinName, _ := pin["name"].(string); pinName != name {
+			continue
+		}
+		pinCID, ok := pin["cid"].(string)
+		if !ok {
+			return nil, xerrors.Errorf("cid field does not exist: %w", ErrUnexpectedResponse)
+		}
+		cids = append(cids, pinCID)
+	}
+	return cids, nil
 }
 
 // PeerLoad checks the load balance of the cluster, namely how many blocks is stored on each
@@ -182,14 +308,13 @@ func (c *Connector) PeerLoad() (string, error) {
 	for decoder.More() {
 		var status map[string]interface{}
 		if err = decoder.Decode(&status); err != nil {
-			panic(err)
+			return "", xerrors.Errorf("fail to decode pin status: %s: %w", err, ErrUnexpectedResponse)
 		}
-		var statusMap = status["peer_map"].(map[string]interface{})
-		for key := range statusMap {
-			pinStatus, ok := statusMap[key].(map[string]interface{})["status"].(string)
-			if !ok {
-				panic("status field does not exist!")
-			}
+		peerStatus, err := peerPinStatus(status)
+		if err != nil {
+			return "", err
+		}
+		for key, pinStatus := range peerStatus {
 			if pinStatus == "pinned" {
 				peerInfo[key]++
 				totBlocks++
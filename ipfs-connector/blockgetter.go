@@ -1,12 +1,23 @@
 package ipfsconnector
 
 import (
+	"bytes"
+	"context"
 	"ipfs-alpha-entanglement-code/entangler"
 	"ipfs-alpha-entanglement-code/util"
+	"time"
 
+	"github.com/ipfs/go-cid"
 	"golang.org/x/xerrors"
 )
 
+// ParityLocation locates a parity inside a packed storage object of its strand
+type ParityLocation struct {
+	Pack   int
+	Offset int
+	Length int
+}
+
 type IPFSGetter struct {
 	entangler.BlockGetter
 	*IPFSConnector
@@ -15,9 +26,22 @@ type IPFSGetter struct {
 	Parity          [][]string
 	ParityFilter    []map[int]struct{}
 
+	// packed parities are read with ranged reads instead of one file per parity
+	ParityPacks     [][]string
+	ParityLocations [][]ParityLocation
+
+	// integrity digests of the parities. Parities are not checked if not set
+	ParityDigests [][]string
+
 	BlockNum int
+
+	// bounds the availability probe of a block
+	ProbeTimeout time.Duration
 }
 
+// DefaultProbeTimeout is the time given to find a provider of a block
+var DefaultProbeTimeout = 5 * time.Second
+
 func CreateIPFSGetter(connector *IPFSConnector, CIDIndexMap map[string]int, parityCIDs [][]string) *IPFSGetter {
 	indexToDataCIDMap := *util.NewSafeMap()
 	indexToDataCIDMap.AddReverseMap(CIDIndexMap)
@@ -29,7 +53,18 @@ func CreateIPFSGetter(connector *IPFSConnector, CIDIndexMap map[string]int, pari
 	}
 }
 
+// UsePackedParities makes the getter read parities from packed storage objects
+func (getter *IPFSGetter) UsePackedParities(packCIDs [][]string, locations [][]ParityLocation) {
+	getter.ParityPacks = packCIDs
+	getter.ParityLocations = locations
+}
+
 func (getter *IPFSGetter) GetData(index int) ([]byte, error) {
+	return getter.GetDataContext(context.Background(), index)
+}
+
+// GetDataContext gets the data block. The download is abandoned when the context is done
+func (getter *IPFSGetter) GetDataContext(ctx context.Context, index int) ([]byte, error) {
 	/* Get the target CID of the block */
 	cid, ok := getter.DataIndexCIDMap.Get(index)
 	if !ok {
@@ -44,24 +79,72 @@ func (getter *IPFSGetter) GetData(index int) ([]byte, error) {
 			return nil, err
 		}
 	}
-	data, err := getter.GetRawBlock(cid)
+	data, err := getter.GetRawBlockContext(ctx, cid)
 	return data, err
 
 }
 
+// VerifyData checks the recovered chunk against the CID of the indexed data block.
+// The recovery pads the chunk with zeros, so the trimmed chunk is checked first
+func (getter *IPFSGetter) VerifyData(index int, data []byte) ([]byte, error) {
+	expected, ok := getter.DataIndexCIDMap.Get(index)
+	if !ok {
+		return nil, xerrors.Errorf("invalid index")
+	}
+	expectedCID, err := cid.Decode(expected)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := [][]byte{bytes.TrimRight(data, "\x00")}
+	if len(candidates[0]) != len(data) {
+		candidates = append(candidates, data)
+	}
+	for _, candidate := range candidates {
+		actualCID, err := expectedCID.Prefix().Sum(candidate)
+		if err == nil && actualCID.Equals(expectedCID) {
+			return candidate, nil
+		}
+	}
+
+	return nil, xerrors.Errorf("recovered data does not match CID %s", expected)
+}
+
+// VerifyParity checks the parity against its digest recorded in the metadata
+func (getter *IPFSGetter) VerifyParity(index int, strand int, data []byte) error {
+	if getter.ParityDigests == nil {
+		return nil
+	}
+	if strand < 0 || strand >= len(getter.ParityDigests) ||
+		index < 1 || index > len(getter.ParityDigests[strand]) {
+		return xerrors.Errorf("no digest for parity %d on strand %d", index, strand)
+	}
+
+	if entangler.ParityDigest(data) != getter.ParityDigests[strand][index-1] {
+		return xerrors.Errorf("parity does not match its digest")
+	}
+	return nil
+}
+
 func (getter *IPFSGetter) GetParity(index int, strand int) ([]byte, error) {
+	return getter.GetParityContext(context.Background(), index, strand)
+}
+
+// GetParityContext gets the parity block. The download is abandoned when the context is done
+func (getter *IPFSGetter) GetParityContext(ctx context.Context, index int, strand int) ([]byte, error) {
 	if index < 1 || index > getter.BlockNum {
 		err := xerrors.Errorf("invalid index")
 		return nil, err
 	}
-	if strand < 0 || strand > len(getter.Parity) {
+	strandNum := len(getter.Parity)
+	if getter.ParityLocations != nil {
+		strandNum = len(getter.ParityLocations)
+	}
+	if strand < 0 || strand >= strandNum {
 		err := xerrors.Errorf("invalid strand")
 		return nil, err
 	}
 
-	/* Get the target CID of the block */
-	cid := getter.Parity[strand][index-1]
-
 	/* Get the parity, mask to represent the parity loss */
 	if getter.ParityFilter != nil && len(getter.ParityFilter) > strand && getter.ParityFilter[strand] != nil {
 		if _, ok := getter.ParityFilter[strand][index]; ok {
@@ -70,7 +153,74 @@ func (getter *IPFSGetter) GetParity(index int, strand int) ([]byte, error) {
 		}
 	}
 
-	data, err := getter.GetFileToMem(cid)
+	/* Read the parity from its pack */
+	if getter.ParityLocations != nil {
+		location := getter.ParityLocations[strand][index-1]
+		cid := getter.ParityPacks[strand][location.Pack]
+		return getter.GetFileRangeToMemContext(ctx, cid, location.Offset, location.Length)
+	}
+
+	/* Get the target CID of the block */
+	cid := getter.Parity[strand][index-1]
+
+	data, err := getter.GetFileRangeToMemContext(ctx, cid, 0, -1)
 	return data, err
 
 }
+
+// Probe checks whether the block can be fetched, without fetching it. The latency is estimated
+// by the duration of the probe, and the size of a packed parity is known from its location
+func (getter *IPFSGetter) Probe(ref entangler.BlockRef) (available bool, size int, latency time.Duration) {
+	var cid string
+	if ref.Parity {
+		if ref.Index < 1 || ref.Index > getter.BlockNum {
+			return false, 0, 0
+		}
+		if getter.ParityFilter != nil && len(getter.ParityFilter) > ref.Strand && getter.ParityFilter[ref.Strand] != nil {
+			if _, ok := getter.ParityFilter[ref.Strand][ref.Index]; ok {
+				return false, 0, 0
+			}
+		}
+		if getter.ParityLocations != nil {
+			if ref.Strand < 0 || ref.Strand >= len(getter.ParityLocations) {
+				return false, 0, 0
+			}
+			location := getter.ParityLocations[ref.Strand][ref.Index-1]
+			cid = getter.ParityPacks[ref.Strand][location.Pack]
+			size = location.Length
+		} else {
+			if ref.Strand < 0 || ref.Strand >= len(getter.Parity) {
+				return false, 0, 0
+			}
+			cid = getter.Parity[ref.Strand][ref.Index-1]
+		}
+	} else {
+		if getter.DataFilter != nil {
+			if _, ok := getter.DataFilter[ref.Index]; ok {
+				return false, 0, 0
+			}
+		}
+		var ok bool
+		cid, ok = getter.DataIndexCIDMap.Get(ref.Index)
+		if !ok {
+			return false, 0, 0
+		}
+	}
+
+	timeout := getter.ProbeTimeout
+	if timeout <= 0 {
+		timeout = DefaultProbeTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	start := time.Now()
+	available, probedSize, err := getter.ProbeBlock(ctx, cid)
+	if err != nil || !available {
+		return false, 0, 0
+	}
+	if size == 0 {
+		size = probedSize
+	}
+	return true, size, time.Since(start)
+}
@@ -3,11 +3,13 @@ package ipfsconnector
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 
 	"ipfs-alpha-entanglement-code/entangler"
+	"ipfs-alpha-entanglement-code/util"
 
 	sh "github.com/ipfs/go-ipfs-api"
 	dag "github.com/ipfs/go-merkledag"
@@ -17,6 +19,8 @@ import (
 // IPFSConnector manages all the interaction with IPFS node
 type IPFSConnector struct {
 	shell *sh.Shell
+
+	Logger *util.Logger
 }
 
 var DefaultPort = 5001
@@ -26,7 +30,7 @@ func CreateIPFSConnector(port int) (*IPFSConnector, error) {
 	if port == 0 {
 		port = DefaultPort
 	}
-	return &IPFSConnector{sh.NewShell(fmt.Sprintf("localhost:%d", port))}, nil
+	return &IPFSConnector{shell: sh.NewShell(fmt.Sprintf("localhost:%d", port)), Logger: util.Default()}, nil
 }
 
 // AddFile takes the file in the given path and writes it to IPFS network
@@ -37,7 +41,12 @@ func (c *IPFSConnector) AddFile(path string) (cid string, err error) {
 	}
 	defer file.Close()
 
-	return c.shell.Add(file)
+	return c.AddReader(file)
+}
+
+// AddReader reads the file from the reader and writes it to IPFS network
+func (c *IPFSConnector) AddReader(r io.Reader) (cid string, err error) {
+	return c.shell.Add(r)
 }
 
 // AddFileFromMem takes the bytes array and upload it to IPFS network as file
@@ -65,16 +74,151 @@ func (c *IPFSConnector) GetFileToMem(cid string) ([]byte, error) {
 	return body, nil
 }
 
+// GetFileToWriter takes the file CID and streams it from IPFS network to the writer
+func (c *IPFSConnector) GetFileToWriter(cid string, w io.Writer) error {
+	data, err := c.shell.Cat(cid)
+	if err != nil {
+		return err
+	}
+	defer data.Close()
+
+	_, err = io.Copy(w, data)
+	return err
+}
+
+// GetFileRangeToMem reads length bytes starting at offset of the file from IPFS network to memory
+func (c *IPFSConnector) GetFileRangeToMem(cid string, offset int, length int) ([]byte, error) {
+	return c.GetFileRangeToMemContext(context.Background(), cid, offset, length)
+}
+
+// GetFileRangeToMemContext is GetFileRangeToMem cancelled with the context.
+// A negative length reads until the end of the file
+func (c *IPFSConnector) GetFileRangeToMemContext(ctx context.Context, cid string, offset int, length int) ([]byte, error) {
+	var buf bytes.Buffer
+	err := c.cat(ctx, cid, int64(offset), int64(length), &buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// GetFileRangeToWriter streams length bytes starting at offset of the file from IPFS network to the writer.
+// A negative length reads until the end of the file
+func (c *IPFSConnector) GetFileRangeToWriter(cid string, offset int64, length int64, w io.Writer) error {
+	return c.cat(context.Background(), cid, offset, length, w)
+}
+
+// cat streams a part of the file to the writer until the context is done
+func (c *IPFSConnector) cat(ctx context.Context, cid string, offset int64, length int64, w io.Writer) error {
+	req := c.shell.Request("cat", cid).Option("offset", offset)
+	if length >= 0 {
+		req = req.Option("length", length)
+	}
+	resp, err := req.Send(ctx)
+	if err != nil {
+		return err
+	}
+	defer resp.Close()
+	if resp.Error != nil {
+		return resp.Error
+	}
+
+	_, err = io.Copy(w, resp.Output)
+	return err
+}
+
 // AddRawData addes raw block data to IPFS network
 func (c *IPFSConnector) AddRawData(chunk []byte) (cid string, err error) {
 	return c.shell.BlockPut(chunk, "v0", "sha2-256", -1)
 }
 
+// AddLinkNode adds a dag-pb node linking to all the given CIDs. Pinning the node recursively pins all of them
+func (c *IPFSConnector) AddLinkNode(cids []string) (cid string, err error) {
+	type link struct {
+		Hash map[string]string
+		Name string
+	}
+	node := struct{ Links []link }{Links: make([]link, len(cids))}
+	for i, child := range cids {
+		// zero padded names keep the links sorted in their original order
+		node.Links[i] = link{Hash: map[string]string{"/": child}, Name: fmt.Sprintf("%08d", i)}
+	}
+
+	rawNode, err := json.Marshal(node)
+	if err != nil {
+		return "", err
+	}
+	return c.shell.DagPut(rawNode, "dag-json", "dag-pb")
+}
+
 // GetRawBlock gets raw block data from IPFS network
 func (c *IPFSConnector) GetRawBlock(cid string) (data []byte, err error) {
 	return c.shell.BlockGet(cid)
 }
 
+// GetRawBlockContext gets raw block data from IPFS network until the context is done
+func (c *IPFSConnector) GetRawBlockContext(ctx context.Context, cid string) (data []byte, err error) {
+	resp, err := c.shell.Request("block/get", cid).Send(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Close()
+	if resp.Error != nil {
+		return nil, resp.Error
+	}
+
+	return io.ReadAll(resp.Output)
+}
+
+// ProbeBlock checks whether a block can be fetched, without fetching it: the block is either
+// in the local store or provided by a peer. The size is only known for local blocks, 0 otherwise
+func (c *IPFSConnector) ProbeBlock(ctx context.Context, cid string) (available bool, size int, err error) {
+	var stat struct {
+		Key  string
+		Size int
+	}
+	err = c.shell.Request("block/stat", cid).Option("offline", true).Exec(ctx, &stat)
+	if err == nil {
+		return true, stat.Size, nil
+	}
+	c.Logger.Debug("Block is not local, look for providers", "cid", cid)
+
+	resp, err := c.shell.Request("routing/findprovs", cid).Option("num-providers", 1).Send(ctx)
+	if err != nil {
+		return false, 0, err
+	}
+	defer resp.Close()
+	if resp.Error != nil {
+		return false, 0, resp.Error
+	}
+
+	decoder := json.NewDecoder(resp.Output)
+	for {
+		var event struct {
+			Type      int
+			Responses []struct{ ID string }
+		}
+		err = decoder.Decode(&event)
+		if err == io.EOF {
+			return false, 0, nil
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				// no provider found in time
+				return false, 0, nil
+			}
+			return false, 0, err
+		}
+		if event.Type == providerEvent && len(event.Responses) > 0 {
+			return true, 0, nil
+		}
+	}
+}
+
+// providerEvent is the type of the routing events reporting a provider
+const providerEvent = 4
+
 // GetDagNodeFromRawBytes unmarshals raw bytes into IPFS dagnode
 func (c *IPFSConnector) GetDagNodeFromRawBytes(chunk []byte) (dagnode *dag.ProtoNode, err error) {
 	dagnode, err = dag.DecodeProtobuf(chunk)
@@ -138,3 +282,17 @@ func (c *IPFSConnector) GetTotalBlocks(cid string) (int, error) {
 	}
 	return filestate.Blocks + 1, nil
 }
+
+// IsUp returns whether the IPFS node answers its API
+func (c *IPFSConnector) IsUp() bool {
+	return c.shell.IsUp()
+}
+
+// FileSize returns the size in bytes of the file with the CID
+func (c *IPFSConnector) FileSize(ctx context.Context, cid string) (int64, error) {
+	stat, err := c.shell.FilesStat(ctx, "/ipfs/"+cid)
+	if err != nil {
+		return 0, err
+	}
+	return int64(stat.Size), nil
+}
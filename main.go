@@ -1,20 +1,21 @@
 package main
 
 import (
+	"fmt"
 	"ipfs-alpha-entanglement-code/cmd"
+	"os"
 )
 
 func main() {
-	// util.Enable_LogPrint()
-	// util.Enable_InfoPrint()
-
 	client, err := cmd.NewClient()
 	if err != nil {
-		panic(err)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
 
+	// the command has already printed its error
 	err = client.Execute()
 	if err != nil {
-		panic(err)
+		os.Exit(1)
 	}
 }
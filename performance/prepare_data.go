@@ -1,5 +1,7 @@
 package performance
 
+import "time"
+
 var alpha = 3
 
 type FileInfo struct {
@@ -24,6 +26,8 @@ type PerfResult struct {
 	FullSuccessCnt    float32
 	RecoverRate       float32
 	DownloadParity    float32
+	Strategy          string
+	Duration          time.Duration
 	Err               error
 }
 
@@ -7,6 +7,7 @@ import (
 	ipfsconnector "ipfs-alpha-entanglement-code/ipfs-connector"
 	"ipfs-alpha-entanglement-code/util"
 	"math/rand"
+	"time"
 
 	"golang.org/x/xerrors"
 )
@@ -121,11 +122,24 @@ func (getter *RecoverGetter) GetParity(index int, strand int) ([]byte, error) {
 }
 
 var Recovery = func(fileinfo FileInfo, metaData Metadata, getter *RecoverGetter) (result PerfResult) {
+	return RecoveryWithStrategy(fileinfo, metaData, getter, entangler.HybridStrategy)
+}
+
+// RecoveryWithStrategy downloads the file through a lattice recovering with the given strategy
+var RecoveryWithStrategy = func(fileinfo FileInfo, metaData Metadata, getter *RecoverGetter,
+	strategy entangler.RecoveryStrategy) (result PerfResult) {
+
 	conn := getter.IPFSConnector
 	chunkNum := len(metaData.DataCIDIndexMap)
+	start := time.Now()
 
 	// create lattice
-	lattice := entangler.NewLattice(metaData.Alpha, metaData.S, metaData.P, chunkNum, getter, 2)
+	lattice, err := entangler.NewLattice(metaData.Alpha, metaData.S, metaData.P, chunkNum, getter, 2)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	lattice.Strategy = strategy
 	lattice.Init()
 
 	// download & recover file from IPFS
@@ -168,34 +182,50 @@ var Recovery = func(fileinfo FileInfo, metaData Metadata, getter *RecoverGetter)
 		}
 	}
 	result.DownloadParity = float32(downloadParity)
+	result.Strategy = strategy.String()
+	result.Duration = time.Since(start)
 
 	return result
 }
 
 var RecoverWithFilter = func(fileinfo FileInfo, missNum int, iteration int, nbNodes int) (result PerfResult) {
-	avgResult := PerfResult{}
+	return CompareStrategies(fileinfo, missNum, iteration, nbNodes, []entangler.RecoveryStrategy{entangler.HybridStrategy})[0]
+}
+
+// CompareStrategies runs the recovery with every strategy on the same random loss patterns
+// and returns the average result of each strategy
+var CompareStrategies = func(fileinfo FileInfo, missNum int, iteration int, nbNodes int,
+	strategies []entangler.RecoveryStrategy) []PerfResult {
+
+	avgResults := make([]PerfResult, len(strategies))
+	fail := func(err error) []PerfResult {
+		for i := range avgResults {
+			avgResults[i].Err = err
+		}
+		return avgResults
+	}
 
 	// create IPFS connector
 	conn, err := ipfsconnector.CreateIPFSConnector(0)
 	if err != nil {
-		return PerfResult{Err: err}
+		return fail(err)
 	}
 
 	// download metafile
 	data, err := conn.GetFileToMem(fileinfo.MetaCID)
 	if err != nil {
-		return PerfResult{Err: err}
+		return fail(err)
 	}
 	var metaData Metadata
 	err = json.Unmarshal(data, &metaData)
 	if err != nil {
-		return PerfResult{Err: err}
+		return fail(err)
 	}
 
 	// create getter
 	getter, err := CreateRecoverGetter(conn, metaData.DataCIDIndexMap, metaData.ParityCIDs)
 	if err != nil {
-		return PerfResult{Err: err}
+		return fail(err)
 	}
 
 	// generate random parity loss and repeat tests
@@ -261,19 +291,28 @@ var RecoverWithFilter = func(fileinfo FileInfo, missNum int, iteration int, nbNo
 		getter.DataFilter = missedDataIndexes
 		getter.ParityFilter = missedParityIndexes
 
-		result := Recovery(fileinfo, metaData, getter)
-		avgResult.RecoverRate += result.RecoverRate
-		avgResult.DownloadParity += result.DownloadParity
-		avgResult.PartialSuccessCnt += result.PartialSuccessCnt
-		if result.PartialSuccessCnt == fileinfo.TotalBlock {
-			avgResult.FullSuccessCnt++
+		for j, strategy := range strategies {
+			avgResult := &avgResults[j]
+			result := RecoveryWithStrategy(fileinfo, metaData, getter, strategy)
+			avgResult.RecoverRate += result.RecoverRate
+			avgResult.DownloadParity += result.DownloadParity
+			avgResult.PartialSuccessCnt += result.PartialSuccessCnt
+			avgResult.Duration += result.Duration
+			if result.PartialSuccessCnt == fileinfo.TotalBlock {
+				avgResult.FullSuccessCnt++
+			}
 		}
 	}
-	avgResult.RecoverRate = avgResult.RecoverRate / float32(iteration)
-	avgResult.DownloadParity = avgResult.DownloadParity / float32(iteration)
-	avgResult.PartialSuccessCnt = avgResult.PartialSuccessCnt / iteration
-	avgResult.FullSuccessCnt = avgResult.FullSuccessCnt / float32(iteration)
-	return avgResult
+	for j, strategy := range strategies {
+		avgResult := &avgResults[j]
+		avgResult.Strategy = strategy.String()
+		avgResult.RecoverRate = avgResult.RecoverRate / float32(iteration)
+		avgResult.DownloadParity = avgResult.DownloadParity / float32(iteration)
+		avgResult.PartialSuccessCnt = avgResult.PartialSuccessCnt / iteration
+		avgResult.FullSuccessCnt = avgResult.FullSuccessCnt / float32(iteration)
+		avgResult.Duration = avgResult.Duration / time.Duration(iteration)
+	}
+	return avgResults
 }
 
 func PerfRecovery(fileCase string, missPercent float32, iteration int) PerfResult {
@@ -286,3 +325,16 @@ func PerfRecovery(fileCase string, missPercent float32, iteration int) PerfResul
 	missNum := int(float32(fileinfo.TotalBlock*alpha) * missPercent)
 	return RecoverWithFilter(fileinfo, missNum, iteration, 0)
 }
+
+// PerfRecoveryStrategies compares the recovery strategies on the same loss patterns
+func PerfRecoveryStrategies(fileCase string, missPercent float32, iteration int,
+	strategies []entangler.RecoveryStrategy) []PerfResult {
+	// check the validity of test case
+	fileinfo, ok := InfoMap[fileCase]
+	if !ok {
+		return []PerfResult{{Err: xerrors.Errorf("invalid test case")}}
+	}
+
+	missNum := int(float32(fileinfo.TotalBlock*alpha) * missPercent)
+	return CompareStrategies(fileinfo, missNum, iteration, 0, strategies)
+}
@@ -1,8 +1,10 @@
 package integration
 
 import (
+	"bytes"
+	"context"
 	"fmt"
-	"ipfs-alpha-entanglement-code/cmd"
+	"ipfs-alpha-entanglement-code/client"
 	"ipfs-alpha-entanglement-code/performance"
 	"os"
 	"testing"
@@ -11,29 +13,27 @@ import (
 )
 
 func Test_Download(t *testing.T) {
-	// util.EnableLogPrint()
+	// util.SetDefault(util.NewLogger(os.Stderr, util.LevelInfo, util.TextFormat))
 	download := func(filepath string, fileCID string, metaCID string, datafilter []int) func(*testing.T) {
 		return func(t *testing.T) {
-			client, err := cmd.NewClient()
+			c, err := client.NewClient(client.ClientOption{})
 			require.NoError(t, err)
 
-			option := cmd.DownloadOption{
-				MetaCID:           metaCID,
+			ref := client.Ref{RootCID: fileCID, MetaCID: metaCID}
+			option := client.DownloadOption{
 				UploadRecoverData: true,
 				DataFilter:        datafilter,
 			}
 
-			out, err := client.Download(fileCID, "", option)
+			var buf bytes.Buffer
+			report, err := c.Download(context.Background(), ref, &buf, option)
 			require.NoError(t, err)
+			require.Equal(t, len(datafilter) > 0, report.Recovered)
+			require.Equal(t, int64(buf.Len()), report.BytesWritten)
 
 			expectedResult, err := os.ReadFile(filepath)
 			require.NoError(t, err)
-			myResult, err := os.ReadFile(out)
-			require.NoError(t, err)
-			require.Equal(t, expectedResult, myResult)
-
-			err = os.Remove(out)
-			require.NoError(t, err)
+			require.Equal(t, expectedResult, buf.Bytes())
 		}
 	}
 
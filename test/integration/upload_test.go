@@ -1,8 +1,9 @@
 package integration
 
 import (
+	"context"
 	"fmt"
-	"ipfs-alpha-entanglement-code/cmd"
+	"ipfs-alpha-entanglement-code/client"
 	"ipfs-alpha-entanglement-code/performance"
 	"testing"
 
@@ -10,21 +11,19 @@ import (
 )
 
 func Test_Upload(t *testing.T) {
-	// util.EnableLogPrint()
+	// util.SetDefault(util.NewLogger(os.Stderr, util.LevelInfo, util.TextFormat))
 	alpha, s, p := 3, 5, 5
 	upload := func(filepath string, expectedCID string, expectedMetaCID string) func(*testing.T) {
 		return func(t *testing.T) {
-			client, err := cmd.NewClient()
+			c, err := client.NewClient(client.ClientOption{})
 			require.NoError(t, err)
 
-			rootCID, metaCID, pinResult, err := client.Upload(filepath, alpha, s, p)
+			option := client.UploadOption{Alpha: alpha, S: s, P: p}
+			result, err := c.UploadFile(context.Background(), filepath, option)
 			require.NoError(t, err)
 
-			require.Equal(t, expectedCID, rootCID)
-			require.Equal(t, expectedMetaCID, metaCID)
-
-			err = pinResult()
-			require.NoError(t, err)
+			require.Equal(t, expectedCID, result.RootCID)
+			require.Equal(t, expectedMetaCID, result.MetaCID)
 		}
 	}
 
@@ -47,7 +47,8 @@ var blockgetterTest = func(filepath string) func(*testing.T) {
 			}
 		}
 		close(data)
-		tangler := entangler.NewEntangler(alpha, s, p)
+		tangler, err := entangler.NewEntangler(alpha, s, p)
+		require.NoError(t, err)
 
 		outputPaths := make([]string, alpha)
 		for k := 0; k < alpha; k++ {
@@ -0,0 +1,106 @@
+package test
+
+import (
+	"bytes"
+	"fmt"
+	"ipfs-alpha-entanglement-code/catalog"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Catalog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), catalog.DefaultFile)
+	files, err := catalog.Open(path)
+	require.NoError(t, err)
+	require.Empty(t, files.List())
+
+	added := time.Date(2022, 7, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, files.Add(catalog.Entry{Name: "a", RootCID: "root2", Added: added.Add(time.Hour),
+		PinStatus: catalog.PinNone}))
+	require.NoError(t, files.Add(catalog.Entry{Name: "a", RootCID: "root1", MetaCID: "meta1",
+		Alpha: 3, S: 5, P: 5, Added: added, PinStatus: catalog.PinPinned}))
+
+	// another instance sees the entries, the oldest first
+	other, err := catalog.Open(path)
+	require.NoError(t, err)
+	entries := other.List()
+	require.Len(t, entries, 2)
+	require.Equal(t, "root1", entries[0].RootCID)
+	require.Equal(t, "root2", entries[1].RootCID)
+
+	// a file is found by its root CID, its metadata CID, or its name for the most recent upload
+	entry, ok := other.Lookup("root1")
+	require.True(t, ok)
+	require.Equal(t, 3, entry.Alpha)
+	entry, ok = other.Lookup("meta1")
+	require.True(t, ok)
+	require.Equal(t, "root1", entry.RootCID)
+	entry, ok = other.Lookup("a")
+	require.True(t, ok)
+	require.Equal(t, "root2", entry.RootCID)
+	_, ok = other.Lookup("unknown")
+	require.False(t, ok)
+
+	// a change made by one instance is read again by the other
+	removed, err := other.Remove("root2")
+	require.NoError(t, err)
+	require.True(t, removed)
+	removed, err = other.Remove("root2")
+	require.NoError(t, err)
+	require.False(t, removed)
+	require.Len(t, files.List(), 1)
+
+	// an export is imported, without replacing more recent entries
+	var exported bytes.Buffer
+	require.NoError(t, files.Export(&exported))
+	imported, err := catalog.Open(filepath.Join(t.TempDir(), catalog.DefaultFile))
+	require.NoError(t, err)
+	require.NoError(t, imported.Add(catalog.Entry{Name: "b", RootCID: "root1", Added: added.Add(time.Hour)}))
+	count, err := imported.Import(bytes.NewReader(exported.Bytes()))
+	require.NoError(t, err)
+	require.Equal(t, 0, count)
+	entry, _ = imported.Get("root1")
+	require.Equal(t, "b", entry.Name)
+
+	// an invalid entry rejects the whole import
+	_, err = imported.Import(bytes.NewReader([]byte(`[{"Name":"c","RootCID":"root2"},{"Name":"d"}]`)))
+	require.Error(t, err)
+	_, ok = imported.Get("root2")
+	require.False(t, ok)
+	reopened, err := catalog.Open(imported.Path())
+	require.NoError(t, err)
+	require.Len(t, reopened.List(), 1)
+}
+
+func Test_Catalog_Concurrent_Writers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), catalog.DefaultFile)
+
+	// each instance stands for a process: only the file lock orders their changes
+	writers, entries := 8, 20
+	var wg sync.WaitGroup
+	errs := make(chan error, writers*entries)
+	for w := 0; w < writers; w++ {
+		files, err := catalog.Open(path)
+		require.NoError(t, err)
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < entries; i++ {
+				errs <- files.Add(catalog.Entry{Name: "file", RootCID: fmt.Sprintf("root-%d-%d", w, i)})
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	files, err := catalog.Open(path)
+	require.NoError(t, err)
+	require.Len(t, files.List(), writers*entries)
+}
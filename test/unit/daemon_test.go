@@ -0,0 +1,135 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"ipfs-alpha-entanglement-code/catalog"
+	"ipfs-alpha-entanglement-code/client"
+	"ipfs-alpha-entanglement-code/daemon"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Daemon_Jobs(t *testing.T) {
+	jobs := daemon.NewJobs(1)
+	defer jobs.Close()
+
+	// the first job holds the only slot until it is cancelled
+	started := make(chan struct{})
+	blocking := jobs.Submit("block", func(ctx context.Context, job *daemon.Job) (interface{}, error) {
+		job.Report("Waiting", 1, 2)
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}, nil)
+	<-started
+	released := make(chan struct{})
+	queued := jobs.Submit("queued", func(ctx context.Context, job *daemon.Job) (interface{}, error) {
+		return "done", nil
+	}, func() { close(released) })
+
+	require.Equal(t, daemon.JobRunning, blocking.Status().State)
+	require.Equal(t, daemon.JobProgress{Stage: "Waiting", Done: 1, Total: 2}, blocking.Status().Progress)
+	require.Equal(t, daemon.JobQueued, queued.Status().State)
+	require.False(t, jobs.Remove(blocking.ID()))
+	require.Len(t, jobs.List(), 2)
+
+	// cancelling the first job starts the queued one
+	require.True(t, jobs.Cancel(blocking.ID()))
+	<-released
+	require.Equal(t, daemon.JobCancelled, blocking.Status().State)
+	require.NotEmpty(t, blocking.Status().Error)
+	require.Equal(t, daemon.JobSucceeded, queued.Status().State)
+	require.Equal(t, "done", queued.Status().Result)
+
+	require.True(t, jobs.Remove(blocking.ID()))
+	_, ok := jobs.Get(blocking.ID())
+	require.False(t, ok)
+	require.False(t, jobs.Cancel(blocking.ID()))
+}
+
+func Test_Daemon_API(t *testing.T) {
+	c, err := client.NewClient(client.ClientOption{})
+	require.NoError(t, err)
+	d, err := daemon.NewDaemon(c, daemon.Option{StateDir: t.TempDir(), CatalogPath: filepath.Join(t.TempDir(), catalog.DefaultFile)})
+	require.NoError(t, err)
+	defer d.Jobs().Close()
+	require.NoError(t, d.Files().Add(catalog.Entry{Name: "file", RootCID: "root", MetaCID: "meta"}))
+	server := httptest.NewServer(d.Handler())
+	defer server.Close()
+
+	request := func(method string, path string) *http.Response {
+		req, err := http.NewRequest(method, server.URL+daemon.APIPrefix+path, strings.NewReader("data"))
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	// the files uploaded through the daemon are listed
+	resp := request(http.MethodGet, "files")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var entries []catalog.Entry
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&entries))
+	require.Len(t, entries, 1)
+	require.Equal(t, "meta", entries[0].MetaCID)
+
+	// invalid requests are rejected before any job starts
+	require.Equal(t, http.StatusBadRequest, request(http.MethodPost, "upload?alpha=3&s=6&p=5").StatusCode)
+	require.Equal(t, http.StatusBadRequest, request(http.MethodPost, "upload?alpha=x").StatusCode)
+	require.Equal(t, http.StatusBadRequest, request(http.MethodPost, "download").StatusCode)
+	require.Equal(t, http.StatusBadRequest, request(http.MethodPost, "download?cid=root&range=x").StatusCode)
+	require.Equal(t, http.StatusMethodNotAllowed, request(http.MethodGet, "upload").StatusCode)
+	require.Equal(t, http.StatusNotFound, request(http.MethodGet, "jobs/unknown").StatusCode)
+	require.Equal(t, http.StatusNotFound, request(http.MethodPost, "maintain?cid=unknown").StatusCode)
+	require.Equal(t, http.StatusBadRequest, request(http.MethodPost, "files?cid=root").StatusCode)
+	require.Equal(t, http.StatusOK, request(http.MethodGet, "files/health").StatusCode)
+
+	// a file is forgotten once
+	require.Equal(t, http.StatusNoContent, request(http.MethodDelete, "files?cid=root").StatusCode)
+	require.Equal(t, http.StatusNotFound, request(http.MethodDelete, "files?cid=root").StatusCode)
+	require.Empty(t, d.Files().List())
+
+	resp = request(http.MethodGet, "jobs")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var statuses []daemon.JobStatus
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&statuses))
+	require.Empty(t, statuses)
+}
+
+func Test_Daemon_AutoRepair(t *testing.T) {
+	dir := t.TempDir()
+	files, err := catalog.Open(filepath.Join(dir, catalog.DefaultFile))
+	require.NoError(t, err)
+	require.NoError(t, files.Add(catalog.Entry{RootCID: "entangled", MetaCID: "meta"}))
+	require.NoError(t, files.Add(catalog.Entry{RootCID: "plain"}))
+
+	// no cluster is running: the maintenance fails and the error is recorded
+	c, err := client.NewClient(client.ClientOption{ClusterPort: 1})
+	require.NoError(t, err)
+	path := filepath.Join(dir, "health.json")
+	option := daemon.RepairOption{Interval: time.Hour}
+	repair, err := daemon.NewAutoRepair(c, files, path, option)
+	require.NoError(t, err)
+	repair.RunOnce(context.Background(), false)
+	health := repair.Health()
+	require.Len(t, health, 1)
+	require.Equal(t, "entangled", health[0].RootCID)
+	require.NotEmpty(t, health[0].Error)
+	require.False(t, health[0].LastCheck.IsZero())
+
+	// the health is persisted, and the file is not due again before the interval
+	repair, err = daemon.NewAutoRepair(c, files, path, option)
+	require.NoError(t, err)
+	repair.RunOnce(context.Background(), false)
+	require.Equal(t, health[0].LastCheck.Unix(), repair.Health()[0].LastCheck.Unix())
+	repair.RunOnce(context.Background(), true)
+	require.True(t, repair.Health()[0].LastCheck.After(health[0].LastCheck))
+}
@@ -0,0 +1,101 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"ipfs-alpha-entanglement-code/client"
+	ipfscluster "ipfs-alpha-entanglement-code/ipfs-cluster"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeCluster answers the requests of the cluster connector, and keeps the names of the added pins.
+// The pin of the CID "refused" fails
+func fakeCluster(t *testing.T) (port int, pins map[string]string, lock *sync.Mutex) {
+	pins = make(map[string]string)
+	lock = &sync.Mutex{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/id", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id":"self","peername":"fake"}`)
+	})
+	mux.HandleFunc("/peers", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id":"self"}`+"\n"+`{"id":"other"}`)
+	})
+	mux.HandleFunc("/pins/ipfs/", func(w http.ResponseWriter, r *http.Request) {
+		cid := r.URL.Path[len("/pins/ipfs/"):]
+		if cid == "refused" {
+			http.Error(w, "pin refused", http.StatusInternalServerError)
+			return
+		}
+		lock.Lock()
+		defer lock.Unlock()
+		pins[cid] = r.URL.Query().Get("name")
+	})
+	mux.HandleFunc("/allocations", func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		for cid, name := range pins {
+			fmt.Fprintf(w, "{\"cid\":%q,\"name\":%q}\n", cid, name)
+		}
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	u, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	port, err = strconv.Atoi(u.Port())
+	require.NoError(t, err)
+	return port, pins, lock
+}
+
+func Test_Cluster_Named_Pins(t *testing.T) {
+	port, pins, lock := fakeCluster(t)
+	conn, err := ipfscluster.CreateIPFSClusterConnector(port)
+	require.NoError(t, err)
+
+	name := client.MetadataPinName("root")
+	require.NoError(t, conn.AddNamedPin("meta", name, 0))
+	require.NoError(t, conn.AddPin("parity", 1))
+	require.ErrorIs(t, conn.AddNamedPin("refused", name, 0), ipfscluster.ErrUnexpectedResponse)
+	lock.Lock()
+	require.Equal(t, map[string]string{"meta": name, "parity": ""}, pins)
+	lock.Unlock()
+
+	cids, err := conn.FindPins(name)
+	require.NoError(t, err)
+	require.Equal(t, []string{"meta"}, cids)
+	cids, err = conn.FindPins(client.MetadataPinName("other"))
+	require.NoError(t, err)
+	require.Empty(t, cids)
+}
+
+func Test_Client_FindMetaCID(t *testing.T) {
+	port, pins, lock := fakeCluster(t)
+
+	// the resolver of the client answers first
+	resolve := func(rootCID string) (string, bool) {
+		return "meta", rootCID == "known"
+	}
+	c, err := client.NewClient(client.ClientOption{ClusterPort: port, IPFSPort: 1, Resolve: resolve})
+	require.NoError(t, err)
+	metaCID, err := c.FindMetaCID(context.Background(), "known")
+	require.NoError(t, err)
+	require.Equal(t, "meta", metaCID)
+
+	// a file without metadata pin has no metadata
+	_, err = c.FindMetaCID(context.Background(), "unknown")
+	require.ErrorIs(t, err, client.ErrMetadataNotFound)
+
+	// a metadata pin that cannot be read is skipped
+	lock.Lock()
+	pins["unreadable"] = client.MetadataPinName("unknown")
+	lock.Unlock()
+	_, err = c.FindMetaCID(context.Background(), "unknown")
+	require.ErrorIs(t, err, client.ErrMetadataNotFound)
+}
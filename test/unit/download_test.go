@@ -0,0 +1,137 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"ipfs-alpha-entanglement-code/client"
+	"ipfs-alpha-entanglement-code/entangler"
+	"testing"
+
+	dag "github.com/ipfs/go-merkledag"
+	unixfs "github.com/ipfs/go-unixfs"
+	"github.com/stretchr/testify/require"
+)
+
+// entangledFile builds a file of 3 subtrees of 4 leaves of 16 bytes, and its entanglement.
+// The blocks are listed in pre-order, the order of their lattice indexes
+func entangledFile(t *testing.T) (content []byte, blocks []*dag.ProtoNode, parities [][][]byte) {
+	newNode := func(sizes []uint64, children []*dag.ProtoNode, data []byte) *dag.ProtoNode {
+		fsn := unixfs.NewFSNode(unixfs.TFile)
+		fsn.SetData(data)
+		for _, size := range sizes {
+			fsn.AddBlockSize(size)
+		}
+		raw, err := fsn.GetBytes()
+		require.NoError(t, err)
+		node := dag.NodeWithData(raw)
+		for _, child := range children {
+			require.NoError(t, node.AddNodeLink("", child))
+		}
+		return node
+	}
+
+	var subtrees []*dag.ProtoNode
+	var leaves [][]*dag.ProtoNode
+	for i := 0; i < 3; i++ {
+		var children []*dag.ProtoNode
+		for j := 0; j < 4; j++ {
+			chunk := bytes.Repeat([]byte{byte('a' + 4*i + j)}, 16)
+			content = append(content, chunk...)
+			children = append(children, newNode(nil, nil, chunk))
+		}
+		leaves = append(leaves, children)
+		subtrees = append(subtrees, newNode([]uint64{16, 16, 16, 16}, children, nil))
+	}
+	root := newNode([]uint64{64, 64, 64}, subtrees, nil)
+
+	blocks = []*dag.ProtoNode{root}
+	for i, subtree := range subtrees {
+		blocks = append(blocks, subtree)
+		blocks = append(blocks, leaves[i]...)
+	}
+
+	tangler, err := entangler.NewEntangler(alpha, s, p)
+	require.NoError(t, err)
+	dataChan := make(chan []byte, len(blocks))
+	for _, block := range blocks {
+		dataChan <- block.RawData()
+	}
+	close(dataChan)
+	parityChan := make(chan entangler.EntangledBlock, alpha*len(blocks))
+	require.NoError(t, tangler.Entangle(dataChan, parityChan))
+	parities = make([][][]byte, alpha)
+	for k := range parities {
+		parities[k] = make([][]byte, len(blocks))
+	}
+	for parity := range parityChan {
+		parities[parity.Strand][parity.LeftBlockIndex-1] = parity.Data
+	}
+
+	return content, blocks, parities
+}
+
+func Test_Download_Partial(t *testing.T) {
+	content, blocks, parities := entangledFile(t)
+
+	// the parities 1 to 13 are lost: the 4th block (2nd leaf) is repaired from the parities
+	// at the end of the lattice, while the 7th block (2nd subtree) cannot be recovered
+	lost := map[int]bool{4: true, 7: true}
+	files, stored := map[string][]byte{}, map[string][]byte{}
+	metaData := client.Metadata{Alpha: alpha, S: s, P: p, RootCID: blocks[0].Cid().String(),
+		DataCIDIndexMap: map[string]int{}, ParityCIDs: make([][]string, alpha)}
+	for i, block := range blocks {
+		metaData.DataCIDIndexMap[block.Cid().String()] = i + 1
+		if !lost[i+1] {
+			stored[block.Cid().String()] = block.RawData()
+		}
+	}
+	for k := range parities {
+		for i, parity := range parities[k] {
+			name := fmt.Sprintf("parity-%d-%d", k, i+1)
+			metaData.ParityCIDs[k] = append(metaData.ParityCIDs[k], name)
+			if i+1 > 13 {
+				files[name] = parity
+			}
+		}
+	}
+	raw, err := json.Marshal(metaData)
+	require.NoError(t, err)
+	files["meta"] = raw
+
+	c, err := client.NewClient(client.ClientOption{IPFSPort: fakeIPFS(t, files, stored)})
+	require.NoError(t, err)
+	ref := client.Ref{RootCID: metaData.RootCID, MetaCID: "meta"}
+	lostCID := blocks[6].Cid().String()
+
+	// the download fails without partial mode
+	var buf bytes.Buffer
+	_, err = c.Download(context.Background(), ref, &buf, client.DownloadOption{})
+	require.Error(t, err)
+
+	// the lost subtree is written as zeros and reported as a hole
+	buf.Reset()
+	report, err := c.Download(context.Background(), ref, &buf, client.DownloadOption{Partial: true})
+	require.NoError(t, err)
+	expected := append([]byte{}, content...)
+	copy(expected[64:128], make([]byte, 64))
+	require.Equal(t, expected, buf.Bytes())
+	require.True(t, report.Recovered)
+	require.Equal(t, []client.Hole{{Offset: 64, Length: 64, CID: lostCID}}, report.Holes)
+
+	// a range cutting through the lost subtree only reports the part of the hole in the range
+	buf.Reset()
+	report, err = c.Download(context.Background(), ref, &buf, client.DownloadOption{Partial: true,
+		Range: &client.ByteRange{Offset: 40, Length: 60}})
+	require.NoError(t, err)
+	require.Equal(t, expected[40:100], buf.Bytes())
+	require.Equal(t, []client.Hole{{Offset: 64, Length: 36, CID: lostCID}}, report.Holes)
+
+	buf.Reset()
+	report, err = c.Download(context.Background(), ref, &buf, client.DownloadOption{Partial: true,
+		Range: &client.ByteRange{Offset: 100, Length: 40}})
+	require.NoError(t, err)
+	require.Equal(t, expected[100:140], buf.Bytes())
+	require.Equal(t, []client.Hole{{Offset: 100, Length: 28, CID: lostCID}}, report.Holes)
+}
@@ -37,7 +37,8 @@ func Test_Entanglement(t *testing.T) {
 			close(dataChan)
 
 			alpha, s, p := 3, 5, 5
-			tangler := entangler.NewEntangler(alpha, s, p)
+			tangler, err := entangler.NewEntangler(alpha, s, p)
+			require.NoError(t, err)
 
 			outputPaths := make([]string, 3)
 			for k := 0; k < alpha; k++ {
@@ -69,3 +70,15 @@ func Test_Entanglement(t *testing.T) {
 	t.Run("median", getTest("randomMedian"))
 	t.Run("large", getTest("randomLarge"))
 }
+
+func Test_Entangler_Invalid_Parameters(t *testing.T) {
+	for _, params := range [][3]int{{0, 1, 1}, {4, 5, 5}, {1, 2, 2}, {3, 6, 5}, {2, 0, 5}} {
+		_, err := entangler.NewEntangler(params[0], params[1], params[2])
+		require.ErrorIs(t, err, entangler.ErrInvalidParameters, "alpha=%d s=%d p=%d", params[0], params[1], params[2])
+	}
+	_, err := entangler.NewLattice(3, 5, 5, -1, nil, 1)
+	require.ErrorIs(t, err, entangler.ErrInvalidParameters)
+
+	_, err = entangler.NewEntangler(1, 1, 0)
+	require.NoError(t, err)
+}
@@ -0,0 +1,44 @@
+package test
+
+import (
+	"ipfs-alpha-entanglement-code/client"
+	"ipfs-alpha-entanglement-code/entangler"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Parse_Byte_Range(t *testing.T) {
+	r, err := client.ParseByteRange("1024:4096")
+	require.NoError(t, err)
+	require.Equal(t, client.ByteRange{Offset: 1024, Length: 4096}, *r)
+
+	r, err = client.ParseByteRange("10:")
+	require.NoError(t, err)
+	require.Equal(t, client.ByteRange{Offset: 10, Length: -1}, *r)
+
+	for _, invalid := range []string{"", "10", "a:10", "10:b", "-1:10", "10:-1"} {
+		_, err = client.ParseByteRange(invalid)
+		require.Error(t, err, invalid)
+	}
+}
+
+func Test_Parse_Hedger(t *testing.T) {
+	hedger, err := client.ParseHedger("off")
+	require.NoError(t, err)
+	require.Nil(t, hedger)
+
+	hedger, err = client.ParseHedger("auto")
+	require.NoError(t, err)
+	require.IsType(t, &entangler.LearnedHedger{}, hedger)
+
+	hedger, err = client.ParseHedger("1500ms")
+	require.NoError(t, err)
+	require.Equal(t, 1500*time.Millisecond, hedger.Delay())
+
+	for _, invalid := range []string{"", "fast", "-1s", "0s"} {
+		_, err = client.ParseHedger(invalid)
+		require.Error(t, err, invalid)
+	}
+}
@@ -0,0 +1,112 @@
+package test
+
+import (
+	"encoding/json"
+	"io"
+	"ipfs-alpha-entanglement-code/client"
+	"ipfs-alpha-entanglement-code/gateway"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	dag "github.com/ipfs/go-merkledag"
+	unixfs "github.com/ipfs/go-unixfs"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Gateway_Requests(t *testing.T) {
+	c, err := client.NewClient(client.ClientOption{})
+	require.NoError(t, err)
+	server := httptest.NewServer(gateway.NewGateway(c, gateway.Option{}))
+	defer server.Close()
+
+	// the gateway is read-only
+	resp, err := http.Post(server.URL+gateway.PathPrefix+"cid", "text/plain", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+	require.Equal(t, "GET, HEAD", resp.Header.Get("Allow"))
+
+	// files are only served under the prefix
+	for _, path := range []string{gateway.PathPrefix, "/other/cid"} {
+		resp, err = http.Get(server.URL + path)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	}
+}
+
+// fakeIPFS answers the cat and block/get requests of the IPFS connector from the content of each CID.
+// The other CIDs and requests fail
+func fakeIPFS(t *testing.T, files map[string][]byte, blocks map[string][]byte) int {
+	mux := http.NewServeMux()
+	serve := func(content map[string][]byte) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			data, ok := content[r.URL.Query().Get("arg")]
+			if !ok {
+				http.Error(w, "block not found", http.StatusInternalServerError)
+				return
+			}
+			if offset, err := strconv.Atoi(r.URL.Query().Get("offset")); err == nil && offset < len(data) {
+				data = data[offset:]
+			}
+			if length, err := strconv.Atoi(r.URL.Query().Get("length")); err == nil && length < len(data) {
+				data = data[:length]
+			}
+			w.Write(data)
+		}
+	}
+	mux.HandleFunc("/api/v0/cat", serve(files))
+	mux.HandleFunc("/api/v0/block/get", serve(blocks))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	u, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	port, err := strconv.Atoi(u.Port())
+	require.NoError(t, err)
+	return port
+}
+
+func Test_Gateway_Missing_Root(t *testing.T) {
+	// a file of one block, whose parities are the block itself, and whose block is missing
+	content := []byte("entangled content")
+	node := dag.NodeWithData(unixfs.FilePBData(content, uint64(len(content))))
+	rootCID := node.Cid().String()
+	metaData, err := json.Marshal(client.Metadata{
+		Alpha: 3, S: 5, P: 5, RootCID: rootCID,
+		DataCIDIndexMap: map[string]int{rootCID: 1},
+		ParityCIDs:      [][]string{{"parity"}, {"parity"}, {"parity"}},
+	})
+	require.NoError(t, err)
+	ipfsPort := fakeIPFS(t, map[string][]byte{"meta": metaData, "parity": node.RawData()}, map[string][]byte{})
+
+	// the metadata is only known by its cluster pin
+	clusterPort, pins, lock := fakeCluster(t)
+	lock.Lock()
+	pins["meta"] = client.MetadataPinName(rootCID)
+	lock.Unlock()
+
+	c, err := client.NewClient(client.ClientOption{IPFSPort: ipfsPort, ClusterPort: clusterPort})
+	require.NoError(t, err)
+	server := httptest.NewServer(gateway.NewGateway(c, gateway.Option{}))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + gateway.PathPrefix + rootCID)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "meta", resp.Header.Get("X-Entangler-Metacid"))
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, content, body)
+
+	// the cached metadata does not serve its file under another CID
+	other := dag.NodeWithData(unixfs.FilePBData([]byte("other content"), 13)).Cid().String()
+	resp, err = http.Get(server.URL + gateway.PathPrefix + other + "?metacid=meta")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
@@ -0,0 +1,150 @@
+package test
+
+import (
+	"ipfs-alpha-entanglement-code/client"
+	ipfsconnector "ipfs-alpha-entanglement-code/ipfs-connector"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Upload_Journal_Resume(t *testing.T) {
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "file")
+	journalPath := filepath.Join(dir, "file.journal")
+	require.NoError(t, os.WriteFile(filePath, []byte("entangled file"), 0600))
+	option := client.UploadOption{Alpha: 3, S: 5, P: 5}
+	resume := option
+	resume.Resume = true
+
+	// first attempt stops after uploading some parities
+	journal, err := client.OpenUploadJournal(journalPath, filePath, option)
+	require.NoError(t, err)
+	require.NoError(t, journal.RecordFile("rootCID"))
+	require.NoError(t, journal.RecordFlatten(2))
+	require.NoError(t, journal.RecordParity(0, 1, "parity01", "digest01"))
+	require.NoError(t, journal.RecordParity(2, 2, "parity22", "digest22"))
+	require.NoError(t, journal.RecordGroup(0, "group0"))
+	require.NoError(t, journal.RecordPin("parity01"))
+	require.NoError(t, journal.Close())
+
+	// resume restores the progress
+	journal, err = client.OpenUploadJournal(journalPath, filePath, resume)
+	require.NoError(t, err)
+	require.Equal(t, "rootCID", journal.RootCID)
+	require.Equal(t, 2, journal.BlockNum)
+	require.False(t, journal.Entangled)
+	require.Empty(t, journal.MetaCID)
+	require.Equal(t, [][]string{{"parity01", ""}, {"", ""}, {"", "parity22"}}, journal.ParityCIDs())
+	require.Equal(t, [][]string{{"digest01", ""}, {"", ""}, {"", "digest22"}}, journal.ParityDigests())
+	require.Equal(t, []string{"group0"}, journal.GroupCIDs())
+	require.True(t, journal.IsPinned("parity01"))
+	require.False(t, journal.IsPinned("parity22"))
+	require.Error(t, journal.RecordFlatten(3))
+	require.NoError(t, journal.Remove())
+
+	// resume without journal or with other parameters fails
+	_, err = client.OpenUploadJournal(journalPath, filePath, resume)
+	require.Error(t, err)
+	journal, err = client.OpenUploadJournal(journalPath, filePath, option)
+	require.NoError(t, err)
+	require.NoError(t, journal.Close())
+	_, err = client.OpenUploadJournal(journalPath, filePath, client.UploadOption{Alpha: 3, S: 2, P: 5, Resume: true})
+	require.Error(t, err)
+}
+
+func Test_Upload_Journal_Packs(t *testing.T) {
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "file")
+	journalPath := filepath.Join(dir, "file.journal")
+	require.NoError(t, os.WriteFile(filePath, []byte("entangled file"), 0600))
+	option := client.UploadOption{Alpha: 1, S: 1, P: 0, PackSize: 2}
+
+	journal, err := client.OpenUploadJournal(journalPath, filePath, option)
+	require.NoError(t, err)
+	require.NoError(t, journal.RecordFlatten(3))
+	require.NoError(t, journal.RecordPack(0, 1, "pack1", []int{7}, []string{"digest3"}))
+	require.NoError(t, journal.RecordPack(0, 0, "pack0", []int{5, 6}, []string{"digest1", "digest2"}))
+	require.NoError(t, journal.Close())
+
+	option.Resume = true
+	journal, err = client.OpenUploadJournal(journalPath, filePath, option)
+	require.NoError(t, err)
+	defer journal.Remove()
+	require.Equal(t, [][]string{{"pack0", "pack1"}}, journal.StorageCIDs())
+	require.Equal(t, [][]string{{"digest1", "digest2", "digest3"}}, journal.ParityDigests())
+	require.Equal(t, [][]ipfsconnector.ParityLocation{{
+		{Pack: 0, Offset: 0, Length: 5},
+		{Pack: 0, Offset: 5, Length: 6},
+		{Pack: 1, Offset: 0, Length: 7},
+	}}, journal.ParityLocations())
+}
+
+func Test_Upload_Journal_Stream(t *testing.T) {
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "file")
+	journalPath := filepath.Join(dir, "stream.journal")
+	require.NoError(t, os.WriteFile(filePath, []byte("entangled file"), 0600))
+	option := client.UploadOption{Alpha: 3, S: 5, P: 5}
+	resume := option
+	resume.Resume = true
+
+	// a streamed file is only matched by the entanglement parameters
+	journal, err := client.OpenUploadJournal(journalPath, "", option)
+	require.NoError(t, err)
+	require.NoError(t, journal.RecordFile("rootCID"))
+	require.NoError(t, journal.Close())
+	journal, err = client.OpenUploadJournal(journalPath, "", resume)
+	require.NoError(t, err)
+	require.Equal(t, "rootCID", journal.RootCID)
+	require.NoError(t, journal.Close())
+
+	// but not by the journal of a file on disk
+	_, err = client.OpenUploadJournal(journalPath, filePath, resume)
+	require.Error(t, err)
+}
+
+func Test_Upload_Journal_Torn_Line(t *testing.T) {
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "file")
+	journalPath := filepath.Join(dir, "file.journal")
+	require.NoError(t, os.WriteFile(filePath, []byte("entangled file"), 0600))
+	option := client.UploadOption{Alpha: 3, S: 5, P: 5}
+	resume := option
+	resume.Resume = true
+
+	journal, err := client.OpenUploadJournal(journalPath, filePath, option)
+	require.NoError(t, err)
+	require.NoError(t, journal.RecordFile("rootCID"))
+	require.NoError(t, journal.RecordFlatten(2))
+	require.NoError(t, journal.Close())
+
+	// the upload is interrupted in the middle of an entry
+	f, err := os.OpenFile(journalPath, os.O_WRONLY|os.O_APPEND, 0600)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"Step":"parity","Str`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	// the first resume drops the torn entry and records after the complete ones
+	journal, err = client.OpenUploadJournal(journalPath, filePath, resume)
+	require.NoError(t, err)
+	require.Equal(t, 2, journal.BlockNum)
+	require.NoError(t, journal.RecordParity(0, 1, "parity01", "digest01"))
+	require.NoError(t, journal.Close())
+
+	// the second resume still sees every entry
+	journal, err = client.OpenUploadJournal(journalPath, filePath, resume)
+	require.NoError(t, err)
+	require.Equal(t, "rootCID", journal.RootCID)
+	require.Equal(t, [][]string{{"parity01", ""}, {"", ""}, {"", ""}}, journal.ParityCIDs())
+	require.NoError(t, journal.RecordPin("parity01"))
+	require.NoError(t, journal.Close())
+
+	journal, err = client.OpenUploadJournal(journalPath, filePath, resume)
+	require.NoError(t, err)
+	require.True(t, journal.IsPinned("parity01"))
+	require.NoError(t, journal.Remove())
+}
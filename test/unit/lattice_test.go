@@ -2,12 +2,15 @@ package test
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"ipfs-alpha-entanglement-code/entangler"
 	"ipfs-alpha-entanglement-code/util"
 	"math/rand"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 	"golang.org/x/xerrors"
@@ -64,14 +67,15 @@ var getTest = func(chunkNum int, chunkSize int, missingIndexes map[int]struct{},
 		}
 
 		// generate parity
-		tangler := entangler.NewEntangler(alpha, s, p)
+		tangler, err := entangler.NewEntangler(alpha, s, p)
+		require.NoError(t, err)
 		dataChan := make(chan []byte, len(data))
 		for _, chunk := range data {
 			dataChan <- chunk
 		}
 		close(dataChan)
 		parityChan := make(chan entangler.EntangledBlock, alpha*len(data))
-		err := tangler.Entangle(dataChan, parityChan)
+		err = tangler.Entangle(dataChan, parityChan)
 		require.NoError(t, err)
 
 		parities := make([][][]byte, alpha)
@@ -92,11 +96,12 @@ var getTest = func(chunkNum int, chunkSize int, missingIndexes map[int]struct{},
 			DataFilter:   missingIndexes,
 			Parity:       parities,
 			ParityFilter: missingParities}
-		util.LogPrintf(util.Green("Finish creating getter"))
+		util.Default().Info("Finish creating getter")
 
-		lattice := entangler.NewLattice(alpha, s, p, chunkNum, &getter, 1)
+		lattice, err := entangler.NewLattice(alpha, s, p, chunkNum, &getter, 1)
+		require.NoError(t, err)
 		lattice.Init()
-		util.LogPrintf(util.Green("Finish generating lattice"))
+		util.Default().Info("Finish generating lattice")
 
 		myData, err := lattice.GetAllData()
 		if !failureExpected {
@@ -127,16 +132,16 @@ func Test_Lattice_No_Recovery(t *testing.T) {
 func Test_Lattice_Single_Data_Lost(t *testing.T) {
 	EnableLog(true)
 	missedFront := func(chunkNum int, chunkSize int) func(*testing.T) {
-		util.LogPrintf("Missing Position: %d\n", 0)
+		util.Default().Info("Missing position", "index", 0)
 		return getTest(chunkNum, chunkSize, map[int]struct{}{0: {}}, []map[int]struct{}{}, false)
 	}
 	missedEnd := func(chunkNum int, chunkSize int) func(*testing.T) {
-		util.LogPrintf("Missing Position: %d\n", chunkNum-1)
+		util.Default().Info("Missing position", "index", chunkNum-1)
 		return getTest(chunkNum, chunkSize, map[int]struct{}{chunkNum - 1: {}}, []map[int]struct{}{}, false)
 	}
 	missedMiddle := func(chunkNum int, chunkSize int) func(*testing.T) {
 		missed := 1 + rand.Intn(chunkNum-1)
-		util.LogPrintf("Missing Position: %d\n", missed)
+		util.Default().Info("Missing position", "index", missed)
 		return getTest(chunkNum, chunkSize, map[int]struct{}{missed: {}}, []map[int]struct{}{}, false)
 	}
 	t.Run("middle", missedMiddle(81, 32))
@@ -167,7 +172,7 @@ func Test_Lattice_Multiple_Data_Lost(t *testing.T) {
 func Test_Lattice_Single_Two_Step_Recovery(t *testing.T) {
 	EnableLog(true)
 	missedFront := func(chunkNum int, chunkSize int) func(*testing.T) {
-		util.LogPrintf("Missing Position: %d\n", 0)
+		util.Default().Info("Missing position", "index", 0)
 		parityMiss := make([]map[int]struct{}, alpha)
 		for k := 0; k < alpha; k++ {
 			parityMiss[k] = map[int]struct{}{0: {}}
@@ -175,7 +180,7 @@ func Test_Lattice_Single_Two_Step_Recovery(t *testing.T) {
 		return getTest(chunkNum, chunkSize, map[int]struct{}{0: {}}, parityMiss, false)
 	}
 	missedEnd := func(chunkNum int, chunkSize int) func(*testing.T) {
-		util.LogPrintf("Missing Position: %d\n", chunkNum-1)
+		util.Default().Info("Missing position", "index", chunkNum-1)
 		parityMiss := make([]map[int]struct{}, alpha)
 		for k := 0; k < alpha; k++ {
 			parityMiss[k] = map[int]struct{}{chunkNum - 1: {}}
@@ -184,7 +189,7 @@ func Test_Lattice_Single_Two_Step_Recovery(t *testing.T) {
 	}
 	missedMiddle := func(chunkNum int, chunkSize int) func(*testing.T) {
 		missed := 1 + rand.Intn(chunkNum-1)
-		util.LogPrintf("Missing Position: %d\n", missed)
+		util.Default().Info("Missing position", "index", missed)
 		parityMiss := make([]map[int]struct{}, alpha)
 		for k := 0; k < alpha; k++ {
 			parityMiss[k] = map[int]struct{}{missed: {}}
@@ -270,7 +275,7 @@ func Test_Lattice_Whole_Data_Lost(t *testing.T) {
 func Test_Lattice_Fail_Recovery(t *testing.T) {
 	EnableLog(true)
 	missedFail := func(chunkNum int, chunkSize int) func(*testing.T) {
-		util.LogPrintf("Missing Position: %d\n", 0)
+		util.Default().Info("Missing position", "index", 0)
 		parityMiss := make([]map[int]struct{}, alpha)
 		for k := 0; k < alpha; k++ {
 			parityMiss[k] = map[int]struct{}{0: {}}
@@ -279,3 +284,803 @@ func Test_Lattice_Fail_Recovery(t *testing.T) {
 	}
 	t.Run("middle", missedFail(5, 32))
 }
+
+// generateEntangledData generates data chunks and their parities
+func generateEntangledData(t *testing.T, chunkNum int, chunkSize int) (data [][]byte, parities [][][]byte) {
+	data = make([][]byte, 0)
+	for i := 0; i < chunkNum; i++ {
+		data = append(data, []byte(strings.Repeat(fmt.Sprintf("%d", i%10), chunkSize)))
+	}
+	tangler, err := entangler.NewEntangler(alpha, s, p)
+	require.NoError(t, err)
+	dataChan := make(chan []byte, len(data))
+	for _, chunk := range data {
+		dataChan <- chunk
+	}
+	close(dataChan)
+	parityChan := make(chan entangler.EntangledBlock, alpha*len(data))
+	require.NoError(t, tangler.Entangle(dataChan, parityChan))
+	parities = make([][][]byte, alpha)
+	for k := 0; k < alpha; k++ {
+		parities[k] = make([][]byte, len(data))
+	}
+	for parity := range parityChan {
+		parities[parity.Strand][parity.LeftBlockIndex-1] = parity.Data
+	}
+
+	return data, parities
+}
+
+func Test_Lattice_Parity_Recovery(t *testing.T) {
+	EnableLog(true)
+	chunkNum, chunkSize := 25, 32
+
+	data, parities := generateEntangledData(t, chunkNum, chunkSize)
+
+	// every parity is recovered even if its left data neighbor is missing too
+	for k := 0; k < alpha; k++ {
+		for i := 0; i < chunkNum; i++ {
+			parityMiss := make([]map[int]struct{}, alpha)
+			for strand := 0; strand < alpha; strand++ {
+				parityMiss[strand] = map[int]struct{}{}
+			}
+			parityMiss[k][i] = struct{}{}
+			getter := SimpleGetter{
+				Data:         data,
+				DataFilter:   map[int]struct{}{i: {}},
+				Parity:       parities,
+				ParityFilter: parityMiss,
+			}
+			lattice, err := entangler.NewLattice(alpha, s, p, chunkNum, &getter, 1)
+			require.NoError(t, err)
+			lattice.Init()
+
+			parity, repaired, err := lattice.GetParity(i+1, k)
+			require.NoError(t, err)
+			require.True(t, repaired)
+			require.Equal(t, parities[k][i], parity)
+		}
+	}
+
+	// invalid positions
+	getter := SimpleGetter{Data: data, Parity: parities, ParityFilter: make([]map[int]struct{}, alpha)}
+	lattice, err := entangler.NewLattice(alpha, s, p, chunkNum, &getter, 1)
+	require.NoError(t, err)
+	lattice.Init()
+	_, _, err = lattice.GetParity(0, 0)
+	require.ErrorIs(t, err, entangler.ErrInvalidParameters)
+	_, _, err = lattice.GetParity(1, alpha)
+	require.ErrorIs(t, err, entangler.ErrInvalidParameters)
+	_, _, err = lattice.GetChunk(chunkNum + 1)
+	require.ErrorIs(t, err, entangler.ErrInvalidParameters)
+}
+
+// VerifyingGetter checks the recovered data against the original data
+type VerifyingGetter struct {
+	SimpleGetter
+}
+
+func (getter *VerifyingGetter) VerifyData(index int, data []byte) ([]byte, error) {
+	if !bytes.Equal(data, getter.Data[index-1]) {
+		return nil, xerrors.Errorf("corrupted data")
+	}
+	return data, nil
+}
+
+func Test_Lattice_Verify_Recovered_Data(t *testing.T) {
+	EnableLog(true)
+	chunkNum, chunkSize, missed := 25, 32, 12
+
+	data, parities := generateEntangledData(t, chunkNum, chunkSize)
+
+	// corrupt the parity used by the first recovery pair of the missing block
+	corrupted := append([]byte{}, parities[0][missed]...)
+	corrupted[0] ^= 0xff
+	parities[0][missed] = corrupted
+
+	for _, depth := range []uint{0, 1} {
+		getter := VerifyingGetter{SimpleGetter{
+			Data:         data,
+			DataFilter:   map[int]struct{}{missed: {}},
+			Parity:       parities,
+			ParityFilter: []map[int]struct{}{{}, {}, {}},
+		}}
+		lattice, err := entangler.NewLattice(alpha, s, p, chunkNum, &getter, depth)
+		require.NoError(t, err)
+		lattice.Init()
+
+		chunk, repaired, err := lattice.GetChunk(missed + 1)
+		require.NoError(t, err)
+		require.True(t, repaired)
+		require.Equal(t, data[missed], chunk)
+	}
+}
+
+// DigestGetter checks the parities against their digests
+type DigestGetter struct {
+	SimpleGetter
+	Digests [][]string
+}
+
+func (getter *DigestGetter) VerifyParity(index int, strand int, data []byte) error {
+	if entangler.ParityDigest(data) != getter.Digests[strand][index-1] {
+		return xerrors.Errorf("corrupted parity")
+	}
+	return nil
+}
+
+func Test_Lattice_Corrupted_Parity(t *testing.T) {
+	EnableLog(true)
+	chunkNum, chunkSize, missed := 25, 32, 12
+	data, parities := generateEntangledData(t, chunkNum, chunkSize)
+
+	digests := make([][]string, alpha)
+	for k := 0; k < alpha; k++ {
+		for _, parity := range parities[k] {
+			digests[k] = append(digests[k], entangler.ParityDigest(parity))
+		}
+	}
+
+	// corrupt the parity used by the first recovery pair of the missing block
+	corrupted := append([]byte{}, parities[0][missed]...)
+	corrupted[0] ^= 0xff
+	parities[0][missed] = corrupted
+
+	for _, depth := range []uint{0, 1} {
+		getter := DigestGetter{
+			SimpleGetter: SimpleGetter{
+				Data:         data,
+				DataFilter:   map[int]struct{}{missed: {}},
+				Parity:       parities,
+				ParityFilter: []map[int]struct{}{{}, {}, {}},
+			},
+			Digests: digests,
+		}
+		lattice, err := entangler.NewLattice(alpha, s, p, chunkNum, &getter, depth)
+		require.NoError(t, err)
+		lattice.Init()
+
+		chunk, repaired, err := lattice.GetChunk(missed + 1)
+		require.NoError(t, err)
+		require.True(t, repaired)
+		require.Equal(t, data[missed], chunk)
+
+		// the corrupted parity itself is recovered instead of downloaded
+		parity, repaired, err := lattice.GetParity(missed+1, 0)
+		require.NoError(t, err)
+		require.True(t, repaired)
+		require.Equal(t, digests[0][missed], entangler.ParityDigest(parity))
+	}
+}
+
+func Test_Lattice_Release_Chunk(t *testing.T) {
+	EnableLog(true)
+	chunkNum, chunkSize := 50, 32
+
+	data, parities := generateEntangledData(t, chunkNum, chunkSize)
+	parityMiss := make([]map[int]struct{}, alpha)
+	for k := 0; k < alpha; k++ {
+		parityMiss[k] = map[int]struct{}{}
+	}
+	getter := SimpleGetter{
+		Data:         data,
+		DataFilter:   map[int]struct{}{3: {}, 20: {}, 21: {}, 40: {}},
+		Parity:       parities,
+		ParityFilter: parityMiss,
+	}
+	lattice, err := entangler.NewLattice(alpha, s, p, chunkNum, &getter, 2)
+	require.NoError(t, err)
+	lattice.Init()
+
+	// consume the chunks in order and release them
+	for i := 0; i < chunkNum; i++ {
+		chunk, _, err := lattice.GetChunk(i + 1)
+		require.NoError(t, err)
+		require.Equal(t, data[i], bytes.Trim(chunk, "\x00"))
+		require.NoError(t, lattice.ReleaseChunk(i+1))
+	}
+
+	// only the parities wrapping the lattice are kept in memory
+	for _, block := range lattice.DataBlocks {
+		require.False(t, block.IsAvailable())
+	}
+	for k := 0; k < alpha; k++ {
+		for _, block := range lattice.ParityBlocks[k] {
+			if !block.IsWrapModified {
+				require.Nil(t, block.Data)
+			}
+		}
+	}
+
+	// a released chunk can still be read again
+	chunk, _, err := lattice.GetChunk(4)
+	require.NoError(t, err)
+	require.Equal(t, data[3], bytes.Trim(chunk, "\x00"))
+	require.Error(t, lattice.ReleaseChunk(chunkNum+1))
+}
+
+func Test_Lattice_Concurrent_Chunks(t *testing.T) {
+	EnableLog(false)
+	chunkNum, chunkSize := 50, 32
+
+	data, parities := generateEntangledData(t, chunkNum, chunkSize)
+	parityMiss := make([]map[int]struct{}, alpha)
+	for k := 0; k < alpha; k++ {
+		parityMiss[k] = map[int]struct{}{5: {}, 30: {}}
+	}
+	getter := SimpleGetter{
+		Data:         data,
+		DataFilter:   map[int]struct{}{3: {}, 4: {}, 20: {}, 21: {}, 40: {}},
+		Parity:       parities,
+		ParityFilter: parityMiss,
+	}
+	lattice, err := entangler.NewLattice(alpha, s, p, chunkNum, &getter, 2)
+	require.NoError(t, err)
+	lattice.Init()
+
+	// the chunks are fetched and released concurrently, as in the parallel DAG walk
+	var wg sync.WaitGroup
+	errs := make(chan error, chunkNum)
+	for i := 0; i < chunkNum; i++ {
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			chunk, _, err := lattice.GetChunk(index + 1)
+			if err == nil && !bytes.Equal(data[index], bytes.Trim(chunk, "\x00")) {
+				err = xerrors.Errorf("wrong chunk %d", index+1)
+			}
+			if err == nil {
+				err = lattice.ReleaseChunk(index + 1)
+			}
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+}
+
+// SlowGetter answers after a random latency, so that concurrent recoveries interleave
+type SlowGetter struct {
+	SimpleGetter
+}
+
+func (getter *SlowGetter) GetData(index int) ([]byte, error) {
+	time.Sleep(time.Duration(rand.Intn(500)) * time.Microsecond)
+	return getter.SimpleGetter.GetData(index)
+}
+
+func (getter *SlowGetter) GetParity(index int, strand int) ([]byte, error) {
+	time.Sleep(time.Duration(rand.Intn(500)) * time.Microsecond)
+	return getter.SimpleGetter.GetParity(index, strand)
+}
+
+func Test_Lattice_Concurrent_Heavy_Loss(t *testing.T) {
+	EnableLog(false)
+	chunkNum, chunkSize, workers := 60, 32, 8
+
+	data, parities := generateEntangledData(t, chunkNum, chunkSize)
+	random := rand.New(rand.NewSource(1))
+	for _, name := range []string{"sequential", "hybrid", "adaptive", "parallel"} {
+		strategy, err := entangler.ParseRecoveryStrategy(name)
+		require.NoError(t, err)
+		for iteration := 0; iteration < 10; iteration++ {
+			// 30% of the data and parities are lost
+			getter := SlowGetter{SimpleGetter{Data: data, DataFilter: map[int]struct{}{}, Parity: parities,
+				ParityFilter: make([]map[int]struct{}, alpha)}}
+			for i := 0; i < chunkNum; i++ {
+				if random.Float64() < 0.3 {
+					getter.DataFilter[i] = struct{}{}
+				}
+			}
+			for k := 0; k < alpha; k++ {
+				getter.ParityFilter[k] = map[int]struct{}{}
+				for i := 0; i < chunkNum; i++ {
+					if random.Float64() < 0.3 {
+						getter.ParityFilter[k][i] = struct{}{}
+					}
+				}
+			}
+			lattice, err := entangler.NewLattice(alpha, s, p, chunkNum, &getter, 2)
+			require.NoError(t, err)
+			lattice.Strategy = strategy
+			lattice.Init()
+
+			// the chunks are fetched by a pool of workers as in the DAG walk. Recoveries holding
+			// blocks needed by each other must not wait for each other
+			indexes := make(chan int, chunkNum)
+			for i := 1; i <= chunkNum; i++ {
+				indexes <- i
+			}
+			close(indexes)
+			wrong := make(chan int, chunkNum)
+			var wg sync.WaitGroup
+			for w := 0; w < workers; w++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for index := range indexes {
+						chunk, _, err := lattice.GetChunkContext(context.Background(), index)
+						if err == nil && !bytes.Equal(data[index-1], bytes.Trim(chunk, "\x00")) {
+							wrong <- index
+						}
+					}
+				}()
+			}
+			done := make(chan struct{})
+			go func() {
+				wg.Wait()
+				close(done)
+			}()
+			select {
+			case <-done:
+			case <-time.After(20 * time.Second):
+				t.Fatalf("%s recovery %d deadlocked", name, iteration)
+			}
+			close(wrong)
+			for index := range wrong {
+				t.Fatalf("%s recovery %d returned a wrong chunk %d", name, iteration, index)
+			}
+		}
+	}
+}
+
+// HangingGetter never returns the filtered data blocks until the download is cancelled,
+// which is how IPFS usually reports a missing block
+type HangingGetter struct {
+	SimpleGetter
+	Hanging map[int]struct{}
+}
+
+func (getter *HangingGetter) GetDataContext(ctx context.Context, index int) ([]byte, error) {
+	if _, ok := getter.Hanging[index-1]; ok {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return getter.GetData(index)
+}
+
+func (getter *HangingGetter) GetParityContext(ctx context.Context, index int, strand int) ([]byte, error) {
+	return getter.GetParity(index, strand)
+}
+
+func Test_Lattice_Hedged_Recovery(t *testing.T) {
+	EnableLog(true)
+	chunkNum, chunkSize := 25, 32
+
+	data, parities := generateEntangledData(t, chunkNum, chunkSize)
+	getter := HangingGetter{
+		SimpleGetter: SimpleGetter{
+			Data:         data,
+			Parity:       parities,
+			ParityFilter: make([]map[int]struct{}, alpha),
+		},
+		Hanging: map[int]struct{}{3: {}, 10: {}},
+	}
+	lattice, err := entangler.NewLattice(alpha, s, p, chunkNum, &getter, 2)
+	require.NoError(t, err)
+	lattice.Hedger = &entangler.FixedHedger{Threshold: 10 * time.Millisecond}
+	lattice.Init()
+
+	// the hanging blocks are repaired instead of waiting forever
+	for _, index := range []int{3, 10} {
+		chunk, repaired, err := lattice.GetChunk(index + 1)
+		require.NoError(t, err)
+		require.True(t, repaired)
+		require.Equal(t, data[index], bytes.Trim(chunk, "\x00"))
+	}
+	chunk, repaired, err := lattice.GetChunk(1)
+	require.NoError(t, err)
+	require.False(t, repaired)
+	require.Equal(t, data[0], chunk)
+}
+
+func Test_Learned_Hedger(t *testing.T) {
+	hedger := entangler.NewLearnedHedger(10*time.Millisecond, time.Second)
+	require.Equal(t, time.Second, hedger.Delay())
+
+	for i := 0; i < 20; i++ {
+		hedger.Observe(20 * time.Millisecond)
+	}
+	delay := hedger.Delay()
+	require.GreaterOrEqual(t, delay, 20*time.Millisecond)
+	require.Less(t, delay, 100*time.Millisecond)
+
+	hedger.Observe(time.Minute)
+	require.Equal(t, time.Second, hedger.Delay())
+}
+
+func Test_Lattice_Recovery_Strategies(t *testing.T) {
+	EnableLog(true)
+	chunkNum, chunkSize := 25, 32
+
+	data, parities := generateEntangledData(t, chunkNum, chunkSize)
+	missedData := map[int]struct{}{}
+	for i := 0; i < chunkNum; i += 2 {
+		missedData[i] = struct{}{}
+	}
+	parityMiss := make([]map[int]struct{}, alpha)
+	for k := 0; k < alpha; k++ {
+		parityMiss[k] = map[int]struct{}{(k + 1) * 3: {}, (k + 1) * 5: {}}
+	}
+
+	// every strategy recovers the same loss pattern
+	for _, name := range []string{"hybrid", "parallel", "adaptive"} {
+		strategy, err := entangler.ParseRecoveryStrategy(name)
+		require.NoError(t, err)
+		require.Equal(t, name, strategy.String())
+
+		getter := SimpleGetter{Data: data, DataFilter: missedData, Parity: parities, ParityFilter: parityMiss}
+		lattice, err := entangler.NewLattice(alpha, s, p, chunkNum, &getter, 2)
+		require.NoError(t, err)
+		lattice.Strategy = strategy
+		lattice.Init()
+		for i := 0; i < chunkNum; i++ {
+			chunk, _, err := lattice.GetChunk(i + 1)
+			require.NoError(t, err, name)
+			require.Equal(t, data[i], bytes.Trim(chunk, "\x00"), name)
+		}
+
+		stats := lattice.Stats()
+		require.Greater(t, stats.Downloads, 0)
+		require.Greater(t, stats.LossRate(), 0.0)
+		require.Less(t, stats.LossRate(), 1.0)
+	}
+
+	// the sequential strategy fails when the recovery needs to go deeper than allowed
+	getter := SimpleGetter{Data: data, DataFilter: missedData, Parity: parities, ParityFilter: parityMiss}
+	lattice, err := entangler.NewLattice(alpha, s, p, chunkNum, &getter, 0)
+	require.NoError(t, err)
+	lattice.Strategy = entangler.SequentialStrategy
+	lattice.Init()
+	_, _, err = lattice.GetChunk(1)
+	require.ErrorIs(t, err, entangler.ErrBlockUnrecoverable)
+	var recoveryErr *entangler.RecoveryError
+	require.ErrorAs(t, err, &recoveryErr)
+	require.Equal(t, entangler.BlockRef{Index: 1}, recoveryErr.Block)
+
+	_, err = entangler.ParseRecoveryStrategy("fastest")
+	require.Error(t, err)
+}
+
+func Test_Lattice_Adaptive_Missing_Blocks(t *testing.T) {
+	EnableLog(false)
+	chunkNum, chunkSize := 25, 32
+
+	// the recovery of the 7th chunk needs more than one step
+	data, parities := generateEntangledData(t, chunkNum, chunkSize)
+	missedData := map[int]struct{}{}
+	for i := 0; i < chunkNum; i++ {
+		if i%3 != 2 {
+			missedData[i] = struct{}{}
+		}
+	}
+	parityMiss := make([]map[int]struct{}, alpha)
+	for k := 0; k < alpha; k++ {
+		parityMiss[k] = map[int]struct{}{}
+		for i := k; i < chunkNum; i += 4 {
+			parityMiss[k][i] = struct{}{}
+		}
+	}
+
+	getter := SimpleGetter{Data: data, DataFilter: missedData, Parity: parities, ParityFilter: parityMiss}
+	lattice, err := entangler.NewLattice(alpha, s, p, chunkNum, &getter, 2)
+	require.NoError(t, err)
+	lattice.Strategy = entangler.AdaptiveStrategy
+	observer := &RecordingObserver{}
+	lattice.Observer = observer
+	lattice.Init()
+
+	chunk, _, err := lattice.GetChunk(7)
+	require.NoError(t, err)
+	require.Equal(t, data[6], bytes.Trim(chunk, "\x00"))
+
+	// the deeper steps repair the blocks found missing without downloading them again
+	failures := map[entangler.BlockRef]int{}
+	observer.Lock()
+	for _, event := range observer.events {
+		if event.Type == entangler.EventDownloadFail {
+			failures[event.Block]++
+		}
+	}
+	observer.Unlock()
+	require.NotEmpty(t, failures)
+	for block, count := range failures {
+		require.Equal(t, 1, count, block)
+	}
+}
+
+// CountingGetter records the highest number of concurrent downloads
+type CountingGetter struct {
+	SimpleGetter
+	sync.Mutex
+	current int
+	max     int
+}
+
+func (getter *CountingGetter) count(download func() ([]byte, error)) ([]byte, error) {
+	getter.Lock()
+	getter.current++
+	if getter.current > getter.max {
+		getter.max = getter.current
+	}
+	getter.Unlock()
+
+	time.Sleep(time.Millisecond)
+	data, err := download()
+
+	getter.Lock()
+	getter.current--
+	getter.Unlock()
+	return data, err
+}
+
+func (getter *CountingGetter) GetData(index int) ([]byte, error) {
+	return getter.count(func() ([]byte, error) { return getter.SimpleGetter.GetData(index) })
+}
+
+func (getter *CountingGetter) GetParity(index int, strand int) ([]byte, error) {
+	return getter.count(func() ([]byte, error) { return getter.SimpleGetter.GetParity(index, strand) })
+}
+
+func Test_Lattice_Bounded_Concurrency(t *testing.T) {
+	EnableLog(false)
+	chunkNum, chunkSize := 50, 32
+
+	data, parities := generateEntangledData(t, chunkNum, chunkSize)
+	missedData := map[int]struct{}{}
+	for i := 0; i < chunkNum; i++ {
+		missedData[i] = struct{}{}
+	}
+	getter := CountingGetter{SimpleGetter: SimpleGetter{
+		Data:         data,
+		DataFilter:   missedData,
+		Parity:       parities,
+		ParityFilter: make([]map[int]struct{}, alpha),
+	}}
+	lattice, err := entangler.NewLattice(alpha, s, p, chunkNum, &getter, 0)
+	require.NoError(t, err)
+	lattice.Strategy = entangler.ParallelStrategy
+	lattice.SetConcurrency(4, 3)
+	lattice.Init()
+
+	// concurrent requests repairing the whole lattice stay within the budget
+	var wg sync.WaitGroup
+	errs := make(chan error, chunkNum)
+	for i := 0; i < chunkNum; i++ {
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			chunk, _, err := lattice.GetChunk(index + 1)
+			if err == nil && !bytes.Equal(data[index], bytes.Trim(chunk, "\x00")) {
+				err = xerrors.Errorf("wrong chunk %d", index+1)
+			}
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+	require.LessOrEqual(t, getter.max, 3)
+	require.Greater(t, getter.max, 0)
+}
+
+// PlanningGetter reports the availability of the blocks of a SimpleGetter
+type PlanningGetter struct {
+	SimpleGetter
+	ParitySize int
+}
+
+func (getter *PlanningGetter) Probe(ref entangler.BlockRef) (bool, int, time.Duration) {
+	if ref.Parity {
+		_, err := getter.GetParity(ref.Index, ref.Strand)
+		return err == nil, getter.ParitySize, 2 * time.Millisecond
+	}
+	data, err := getter.GetData(ref.Index)
+	return err == nil, len(data), time.Millisecond
+}
+
+// executePlan fetches the blocks of the plan and applies its repairs
+func executePlan(t *testing.T, getter *PlanningGetter, plan *entangler.RecoveryPlan) map[entangler.BlockRef][]byte {
+	blocks := map[entangler.BlockRef][]byte{}
+	for _, fetch := range plan.Fetches {
+		var data []byte
+		var err error
+		if fetch.Block.Parity {
+			data, err = getter.GetParity(fetch.Block.Index, fetch.Block.Strand)
+		} else {
+			data, err = getter.GetData(fetch.Block.Index)
+		}
+		require.NoError(t, err)
+		blocks[fetch.Block] = data
+	}
+	for _, repair := range plan.Repairs {
+		left, okLeft := blocks[repair.Left]
+		right, okRight := blocks[repair.Right]
+		require.True(t, okLeft && okRight, "repair of %s before its pair", repair.Target)
+		if repair.Left == repair.Right {
+			blocks[repair.Target] = left
+			continue
+		}
+		size := len(left)
+		if len(right) > size {
+			size = len(right)
+		}
+		result := make([]byte, size)
+		copy(result, left)
+		for i := range right {
+			result[i] ^= right[i]
+		}
+		blocks[repair.Target] = result
+	}
+	return blocks
+}
+
+func Test_Lattice_Recovery_Plan(t *testing.T) {
+	EnableLog(false)
+	chunkNum, chunkSize := 25, 32
+
+	data, parities := generateEntangledData(t, chunkNum, chunkSize)
+	indexes := make([]int, chunkNum)
+	for i := range indexes {
+		indexes[i] = i + 1
+	}
+	newLattice := func(getter *PlanningGetter) *entangler.Lattice {
+		lattice, err := entangler.NewLattice(alpha, s, p, chunkNum, getter, 2)
+		require.NoError(t, err)
+		lattice.Init()
+		return lattice
+	}
+
+	// nothing is lost: every chunk is fetched directly
+	getter := &PlanningGetter{SimpleGetter: SimpleGetter{Data: data, Parity: parities,
+		ParityFilter: make([]map[int]struct{}, alpha)}, ParitySize: chunkSize}
+	plan, err := newLattice(getter).Plan(indexes, getter, entangler.CostBlocks)
+	require.NoError(t, err)
+	require.Len(t, plan.Fetches, chunkNum)
+	require.Empty(t, plan.Repairs)
+	require.Empty(t, plan.Unrecoverable)
+	require.Equal(t, float64(chunkNum), plan.Cost)
+
+	// the plan rebuilds the lost chunks, fetching shared blocks once
+	missedData := map[int]struct{}{}
+	for i := 0; i < chunkNum; i += 2 {
+		missedData[i] = struct{}{}
+	}
+	parityMiss := make([]map[int]struct{}, alpha)
+	for k := 0; k < alpha; k++ {
+		parityMiss[k] = map[int]struct{}{(k + 1) * 3: {}, (k + 1) * 5: {}}
+	}
+	getter = &PlanningGetter{SimpleGetter: SimpleGetter{Data: data, DataFilter: missedData, Parity: parities,
+		ParityFilter: parityMiss}, ParitySize: 4 * chunkSize}
+	for _, model := range []entangler.CostModel{entangler.CostBlocks, entangler.CostBytes, entangler.CostLatency} {
+		plan, err = newLattice(getter).Plan(indexes, getter, model)
+		require.NoError(t, err, model.String())
+		require.Empty(t, plan.Unrecoverable, model.String())
+		require.NotEmpty(t, plan.Repairs, model.String())
+
+		fetched := map[entangler.BlockRef]struct{}{}
+		for _, fetch := range plan.Fetches {
+			_, ok := fetched[fetch.Block]
+			require.False(t, ok, "%s fetched twice", fetch.Block)
+			fetched[fetch.Block] = struct{}{}
+		}
+		blocks := executePlan(t, getter, plan)
+		for i := 0; i < chunkNum; i++ {
+			chunk, ok := blocks[entangler.BlockRef{Index: i + 1}]
+			require.True(t, ok, model.String())
+			require.Equal(t, data[i], bytes.Trim(chunk, "\x00"), model.String())
+		}
+	}
+
+	// the cost follows the model
+	blocksPlan, err := newLattice(getter).Plan(indexes, getter, entangler.CostBlocks)
+	require.NoError(t, err)
+	require.Equal(t, float64(len(blocksPlan.Fetches)), blocksPlan.Cost)
+	bytesPlan, err := newLattice(getter).Plan(indexes, getter, entangler.CostBytes)
+	require.NoError(t, err)
+	require.Equal(t, float64(bytesPlan.Bytes), bytesPlan.Cost)
+
+	// a single lost chunk is rebuilt from one pair
+	getter = &PlanningGetter{SimpleGetter: SimpleGetter{Data: data, DataFilter: map[int]struct{}{9: {}},
+		Parity: parities, ParityFilter: make([]map[int]struct{}, alpha)}, ParitySize: chunkSize}
+	plan, err = newLattice(getter).Plan([]int{10}, getter, entangler.CostBlocks)
+	require.NoError(t, err)
+	require.Len(t, plan.Fetches, 2)
+	require.Len(t, plan.Repairs, 1)
+	require.Equal(t, entangler.BlockRef{Index: 10}, plan.Repairs[0].Target)
+	require.Equal(t, data[9], bytes.Trim(executePlan(t, getter, plan)[entangler.BlockRef{Index: 10}], "\x00"))
+
+	// nothing is available
+	allData := map[int]struct{}{}
+	for i := 0; i < chunkNum; i++ {
+		allData[i] = struct{}{}
+	}
+	allParities := make([]map[int]struct{}, alpha)
+	for k := range allParities {
+		allParities[k] = allData
+	}
+	getter = &PlanningGetter{SimpleGetter: SimpleGetter{Data: data, DataFilter: allData, Parity: parities,
+		ParityFilter: allParities}}
+	plan, err = newLattice(getter).Plan(indexes, getter, entangler.CostBlocks)
+	require.NoError(t, err)
+	require.Equal(t, indexes, plan.Unrecoverable)
+	require.Empty(t, plan.Fetches)
+
+	_, err = entangler.ParseCostModel("cheapest")
+	require.Error(t, err)
+}
+
+// RecordingObserver records the events of the recovery
+type RecordingObserver struct {
+	sync.Mutex
+	events []entangler.Event
+}
+
+func (observer *RecordingObserver) Observe(event entangler.Event) {
+	observer.Lock()
+	defer observer.Unlock()
+	observer.events = append(observer.events, event)
+}
+
+func (observer *RecordingObserver) find(eventType entangler.EventType, block entangler.BlockRef) []entangler.Event {
+	observer.Lock()
+	defer observer.Unlock()
+	var found []entangler.Event
+	for _, event := range observer.events {
+		if event.Type == eventType && event.Block == block {
+			found = append(found, event)
+		}
+	}
+	return found
+}
+
+func Test_Lattice_Recovery_Events(t *testing.T) {
+	EnableLog(false)
+	chunkNum, chunkSize := 25, 32
+
+	data, parities := generateEntangledData(t, chunkNum, chunkSize)
+	for _, strategy := range []entangler.RecoveryStrategy{entangler.SequentialStrategy, entangler.ParallelStrategy} {
+		getter := SimpleGetter{Data: data, DataFilter: map[int]struct{}{9: {}}, Parity: parities,
+			ParityFilter: make([]map[int]struct{}, alpha)}
+		lattice, err := entangler.NewLattice(alpha, s, p, chunkNum, &getter, 2)
+		require.NoError(t, err)
+		lattice.Strategy = strategy
+		observer := &RecordingObserver{}
+		lattice.Observer = entangler.MultiObserver(entangler.LogObserver{}, observer)
+		lattice.Init()
+
+		chunk, repaired, err := lattice.GetChunk(10)
+		require.NoError(t, err)
+		require.True(t, repaired)
+		require.Equal(t, data[9], bytes.Trim(chunk, "\x00"))
+
+		target := entangler.BlockRef{Index: 10}
+		parallel := strategy == entangler.ParallelStrategy
+		require.Len(t, observer.find(entangler.EventDownloadStart, target), 1)
+		failed := observer.find(entangler.EventDownloadFail, target)
+		require.Len(t, failed, 1)
+		require.Error(t, failed[0].Err)
+		require.Equal(t, parallel, failed[0].Parallel)
+		require.NotEmpty(t, observer.find(entangler.EventRepairAttempt, target))
+
+		repairs := observer.find(entangler.EventRepairSuccess, target)
+		require.Len(t, repairs, 1)
+		repair := repairs[0]
+		require.Equal(t, 0, repair.Depth)
+		require.Equal(t, chunkSize, repair.Size)
+		require.False(t, repair.Time.IsZero())
+
+		// the pair used was downloaded one level deeper
+		for _, side := range []entangler.BlockRef{repair.Left, repair.Right} {
+			downloads := observer.find(entangler.EventDownloadSuccess, side)
+			require.NotEmpty(t, downloads, side.String())
+			require.Equal(t, 1, downloads[0].Depth)
+			require.Greater(t, downloads[0].Size, 0)
+		}
+	}
+}
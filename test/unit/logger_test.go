@@ -0,0 +1,65 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"ipfs-alpha-entanglement-code/util"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+)
+
+func Test_Logger_Text(t *testing.T) {
+	var buf bytes.Buffer
+	logger := util.NewLogger(&buf, util.LevelInfo, util.TextFormat)
+	logger.Debug("hidden")
+	logger.With("cid", "QmX").Info("Block downloaded", "index", 3, "path", "my file")
+
+	line := buf.String()
+	require.NotContains(t, line, "hidden")
+	require.Contains(t, line, "INFO  Block downloaded cid=QmX index=3 path=\"my file\"")
+	// no color when the output is not a terminal
+	require.NotContains(t, line, "\033[")
+	require.Equal(t, 1, strings.Count(line, "\n"))
+}
+
+func Test_Logger_JSON(t *testing.T) {
+	var buf bytes.Buffer
+	logger := util.NewLogger(&buf, util.LevelDebug, util.JSONFormat).With("request", 7)
+	logger.Warn("Reject block", "err", xerrors.New("bad digest"), "duration", time.Second, "parity", true)
+
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	require.Equal(t, "warn", entry["level"])
+	require.Equal(t, "Reject block", entry["msg"])
+	require.Equal(t, float64(7), entry["request"])
+	require.Equal(t, "bad digest", entry["err"])
+	require.Equal(t, "1s", entry["duration"])
+	require.Equal(t, true, entry["parity"])
+}
+
+func Test_Logger_Levels(t *testing.T) {
+	var buf bytes.Buffer
+	logger := util.NewLogger(&buf, util.LevelOff, util.TextFormat)
+	logger.Error("hidden")
+	require.Empty(t, buf.String())
+
+	// a nil logger discards everything
+	var nilLogger *util.Logger
+	nilLogger.With("index", 1).Error("hidden")
+	require.False(t, nilLogger.Enabled(util.LevelError))
+
+	level, err := util.ParseLevel("DEBUG")
+	require.NoError(t, err)
+	require.Equal(t, util.LevelDebug, level)
+	_, err = util.ParseLevel("verbose")
+	require.Error(t, err)
+	format, err := util.ParseFormat("json")
+	require.NoError(t, err)
+	require.Equal(t, util.JSONFormat, format)
+	_, err = util.ParseFormat("xml")
+	require.Error(t, err)
+}
@@ -0,0 +1,41 @@
+package test
+
+import (
+	"ipfs-alpha-entanglement-code/client"
+	ipfsconnector "ipfs-alpha-entanglement-code/ipfs-connector"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Metadata_Validate(t *testing.T) {
+	valid := func() *client.Metadata {
+		return &client.Metadata{
+			Alpha:           2,
+			S:               1,
+			P:               2,
+			DataCIDIndexMap: map[string]int{"a": 1, "b": 2},
+			ParityCIDs:      [][]string{{"p1", "p2"}, {"q1", "q2"}},
+		}
+	}
+	require.NoError(t, valid().Validate())
+
+	corrupt := map[string]func(m *client.Metadata){
+		"parameters":      func(m *client.Metadata) { m.S = 3 },
+		"index range":     func(m *client.Metadata) { m.DataCIDIndexMap["b"] = 3 },
+		"duplicate index": func(m *client.Metadata) { m.DataCIDIndexMap["b"] = 1 },
+		"missing strand":  func(m *client.Metadata) { m.ParityCIDs = m.ParityCIDs[:1] },
+		"missing parity":  func(m *client.Metadata) { m.ParityCIDs[1] = m.ParityCIDs[1][:1] },
+		"digests":         func(m *client.Metadata) { m.ParityDigests = [][]string{{"d1", "d2"}} },
+		"packed locations": func(m *client.Metadata) {
+			m.ParityCIDs = nil
+			m.ParityPackCIDs = [][]string{{"pack"}, {"pack"}}
+			m.ParityLocations = [][]ipfsconnector.ParityLocation{{{}, {}}, {{}, {Pack: 1}}}
+		},
+	}
+	for name, corruption := range corrupt {
+		m := valid()
+		corruption(m)
+		require.ErrorIs(t, m.Validate(), client.ErrMetadataCorrupt, name)
+	}
+}
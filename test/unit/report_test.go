@@ -0,0 +1,52 @@
+package test
+
+import (
+	"encoding/json"
+	"ipfs-alpha-entanglement-code/client"
+	"ipfs-alpha-entanglement-code/entangler"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Download_Report(t *testing.T) {
+	EnableLog(false)
+	chunkNum, chunkSize := 25, 32
+
+	data, parities := generateEntangledData(t, chunkNum, chunkSize)
+	getter := SimpleGetter{Data: data, DataFilter: map[int]struct{}{4: {}, 9: {}}, Parity: parities,
+		ParityFilter: make([]map[int]struct{}, alpha)}
+	lattice, err := entangler.NewLattice(alpha, s, p, chunkNum, &getter, 2)
+	require.NoError(t, err)
+	report := &client.DownloadReport{}
+	observer := client.NewReportObserver(report)
+	lattice.Observer = observer
+	lattice.Init()
+
+	_, err = lattice.GetAllData()
+	require.NoError(t, err)
+	observer.Finish()
+
+	require.Equal(t, []int{5, 10}, report.DataRepaired)
+	require.Len(t, report.DataFetched, chunkNum-2)
+	require.NotContains(t, report.DataFetched, 5)
+	require.NotEmpty(t, report.ParitiesFetched)
+	require.Empty(t, report.ParitiesRepaired)
+	require.Len(t, report.Repairs, 2)
+	require.Equal(t, 1, report.RecoveryDepth)
+	require.Equal(t, 2, report.FailedDownloads)
+	require.Equal(t, chunkNum-2+len(report.ParitiesFetched), report.Downloads-report.FailedDownloads)
+	require.Equal(t, int64(2*chunkSize), report.BytesRepaired)
+
+	// the report is written as JSON
+	path := filepath.Join(t.TempDir(), "report.json")
+	require.NoError(t, client.WriteReport(path, report))
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var decoded client.DownloadReport
+	require.NoError(t, json.Unmarshal(raw, &decoded))
+	require.Equal(t, report.Repairs, decoded.Repairs)
+	require.Equal(t, report.DataRepaired, decoded.DataRepaired)
+}
@@ -0,0 +1,164 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"ipfs-alpha-entanglement-code/client"
+	"ipfs-alpha-entanglement-code/entangler"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeUploadIPFS serves the IPFS API used by an upload: the file is added with the CID "root", whose
+// DAG has the given number of leaves. The other added files and the DAG nodes are handled by add and put
+func fakeUploadIPFS(t *testing.T, leaves int, add func(content []byte) (cid string, err error),
+	put func(links []string) string) int {
+
+	mux := http.NewServeMux()
+	var adds int32
+	mux.HandleFunc("/api/v0/add", func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&adds, 1) == 1 {
+			fmt.Fprint(w, `{"Hash":"root"}`)
+			return
+		}
+		content, err := readPart(r)
+		if err == nil {
+			var cid string
+			cid, err = add(content)
+			if err == nil {
+				fmt.Fprintf(w, `{"Hash":%q}`, cid)
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"Message":%q,"Code":0,"Type":"error"}`, err.Error())
+	})
+	mux.HandleFunc("/api/v0/dag/put", func(w http.ResponseWriter, r *http.Request) {
+		content, err := readPart(r)
+		require.NoError(t, err)
+		var node struct{ Links []struct{ Hash map[string]string } }
+		require.NoError(t, json.Unmarshal(content, &node))
+		links := make([]string, len(node.Links))
+		for i, link := range node.Links {
+			links[i] = link.Hash["/"]
+		}
+		fmt.Fprintf(w, `{"Cid":{"/":%q}}`, put(links))
+	})
+	mux.HandleFunc("/api/v0/object/get", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("arg") != "root" {
+			fmt.Fprint(w, `{"Links":[],"Data":""}`)
+			return
+		}
+		links := make([]string, leaves)
+		for i := range links {
+			links[i] = fmt.Sprintf(`{"Name":"","Hash":"leaf%d","Size":8}`, i)
+		}
+		fmt.Fprintf(w, `{"Links":[%s],"Data":""}`, strings.Join(links, ","))
+	})
+	mux.HandleFunc("/api/v0/block/get", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "data of "+r.URL.Query().Get("arg"))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	u, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	port, err := strconv.Atoi(u.Port())
+	require.NoError(t, err)
+	return port
+}
+
+// readPart reads the file sent in the multipart body of the request
+func readPart(r *http.Request) ([]byte, error) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	part, err := reader.NextPart()
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(part)
+}
+
+func Test_Upload_Parity_Failure(t *testing.T) {
+	// IPFS adds the file, then refuses every parity
+	workers := 4
+	var adds int32
+	port := fakeUploadIPFS(t, 40, func(content []byte) (string, error) {
+		atomic.AddInt32(&adds, 1)
+		return "", fmt.Errorf("disk full")
+	}, func(links []string) string { return "group" })
+
+	c, err := client.NewClient(client.ClientOption{IPFSPort: port})
+	require.NoError(t, err)
+	result, err := c.Upload(context.Background(), strings.NewReader("file"),
+		client.UploadOption{Alpha: 3, S: 5, P: 5, AddWorkers: workers})
+
+	// the cause of the first failure is returned, and no parity upload starts after it
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "disk full")
+	require.Equal(t, "root", result.RootCID)
+	require.Empty(t, result.MetaCID)
+	parityAdds := int(atomic.LoadInt32(&adds))
+	require.Greater(t, parityAdds, 0)
+	require.LessOrEqual(t, parityAdds, workers)
+}
+
+func Test_Upload_Parity_Groups(t *testing.T) {
+	// 41 blocks make two windows of 25 parities per strand
+	var lock sync.Mutex
+	var metaData client.Metadata
+	parities := 0
+	groups := map[string][]string{}
+	port := fakeUploadIPFS(t, 40, func(content []byte) (string, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		if bytes.HasPrefix(content, []byte(`{"Alpha":`)) {
+			return "meta", json.Unmarshal(content, &metaData)
+		}
+		parities++
+		return fmt.Sprintf("parity-%d", parities), nil
+	}, func(links []string) string {
+		lock.Lock()
+		defer lock.Unlock()
+		cid := fmt.Sprintf("group-%d", len(groups))
+		groups[cid] = links
+		return cid
+	})
+	clusterPort, pins, pinLock := fakeCluster(t)
+
+	c, err := client.NewClient(client.ClientOption{IPFSPort: port, ClusterPort: clusterPort})
+	require.NoError(t, err)
+	result, err := c.Upload(context.Background(), strings.NewReader("file"),
+		client.UploadOption{Alpha: 3, S: 5, P: 5, PinGroup: client.PinGroupWindow})
+	require.NoError(t, err)
+	require.Equal(t, "meta", result.MetaCID)
+	require.Len(t, metaData.ParityGroupCIDs, 6)
+	pinLock.Lock()
+	for _, group := range metaData.ParityGroupCIDs {
+		require.Contains(t, pins, group)
+	}
+	pinLock.Unlock()
+
+	// every parity is pinned again through the group linking it
+	for strand := 0; strand < metaData.Alpha; strand++ {
+		for index := 1; index <= len(metaData.DataCIDIndexMap); index++ {
+			group, ok := metaData.ParityPinCID(entangler.BlockRef{Index: index, Strand: strand, Parity: true})
+			require.True(t, ok)
+			require.Contains(t, groups[group], metaData.ParityCIDs[strand][index-1])
+		}
+	}
+}
@@ -2,6 +2,7 @@ package test
 
 import (
 	"ipfs-alpha-entanglement-code/util"
+	"os"
 	"sync"
 )
 
@@ -10,7 +11,7 @@ var once sync.Once
 func EnableLog(enable bool) {
 	once.Do(func() {
 		if enable {
-			util.EnableLogPrint()
+			util.SetDefault(util.NewLogger(os.Stderr, util.LevelInfo, util.TextFormat))
 		}
 	})
 }
@@ -0,0 +1,24 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// ConfigDirEnv overrides the directory where the local state of the entangler is kept
+const ConfigDirEnv = "ENTANGLER_HOME"
+
+// ConfigDir returns the directory storing the local state (journals, etc.) and creates it if necessary
+func ConfigDir() (dir string, err error) {
+	dir = os.Getenv(ConfigDirEnv)
+	if len(dir) == 0 {
+		dir, err = os.UserConfigDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(dir, "entangler")
+	}
+
+	err = os.MkdirAll(dir, 0700)
+	return dir, err
+}
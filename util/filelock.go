@@ -0,0 +1,25 @@
+package util
+
+import "os"
+
+// LockFile takes an exclusive advisory lock on the lock file of the path, shared by the processes
+// changing the file. It waits while another process holds the lock. The returned function releases it
+func LockFile(path string) (unlock func() error, err error) {
+	f, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	err = lockFile(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() error {
+		err := unlockFile(f)
+		closeErr := f.Close()
+		if err != nil {
+			return err
+		}
+		return closeErr
+	}, nil
+}
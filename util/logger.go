@@ -0,0 +1,243 @@
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// Level is the severity of a log entry
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+	// LevelOff disables the logger
+	LevelOff
+)
+
+var levelNames = map[Level]string{
+	LevelDebug: "debug",
+	LevelInfo:  "info",
+	LevelWarn:  "warn",
+	LevelError: "error",
+	LevelOff:   "off",
+}
+
+var levelColors = map[Level]func(...interface{}) string{
+	LevelDebug: Teal,
+	LevelInfo:  Green,
+	LevelWarn:  Yellow,
+	LevelError: Red,
+}
+
+// String returns the name of the level
+func (l Level) String() string {
+	name, ok := levelNames[l]
+	if !ok {
+		return "unknown"
+	}
+	return name
+}
+
+// ParseLevel returns the level with the given name
+func ParseLevel(name string) (Level, error) {
+	for level, levelName := range levelNames {
+		if levelName == strings.ToLower(name) {
+			return level, nil
+		}
+	}
+	return LevelOff, xerrors.Errorf("invalid log level %q: expected debug, info, warn, error or off", name)
+}
+
+// Format is the encoding of the log entries
+type Format int
+
+const (
+	// TextFormat writes one readable line per entry, with key=value fields
+	TextFormat Format = iota
+	// JSONFormat writes one JSON object per line
+	JSONFormat
+)
+
+// ParseFormat returns the format with the given name
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(name) {
+	case "text":
+		return TextFormat, nil
+	case "json":
+		return JSONFormat, nil
+	}
+	return TextFormat, xerrors.Errorf("invalid log format %q: expected text or json", name)
+}
+
+// Logger writes levelled entries with key/value fields. It is safe for concurrent use,
+// and a nil logger discards everything
+type Logger struct {
+	mu     *sync.Mutex
+	out    io.Writer
+	level  Level
+	format Format
+	color  bool
+	fields []interface{}
+}
+
+// NewLogger creates a logger writing the entries from the given level. The text format is
+// colored only when the output is a terminal
+func NewLogger(out io.Writer, level Level, format Format) *Logger {
+	return &Logger{
+		mu:     &sync.Mutex{},
+		out:    out,
+		level:  level,
+		format: format,
+		color:  format == TextFormat && IsTerminal(out),
+	}
+}
+
+// IsTerminal returns whether the writer is a terminal
+func IsTerminal(w io.Writer) bool {
+	file, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// With returns a logger adding the key/value fields to every entry
+func (l *Logger) With(keyValues ...interface{}) *Logger {
+	if l == nil {
+		return nil
+	}
+	child := *l
+	child.fields = append(append([]interface{}{}, l.fields...), keyValues...)
+	return &child
+}
+
+// Enabled returns whether the entries of the level are written
+func (l *Logger) Enabled(level Level) bool {
+	return l != nil && level >= l.level && level < LevelOff
+}
+
+// Debug writes a debug entry with key/value fields
+func (l *Logger) Debug(msg string, keyValues ...interface{}) {
+	l.log(LevelDebug, msg, keyValues)
+}
+
+// Info writes an info entry with key/value fields
+func (l *Logger) Info(msg string, keyValues ...interface{}) {
+	l.log(LevelInfo, msg, keyValues)
+}
+
+// Warn writes a warning entry with key/value fields
+func (l *Logger) Warn(msg string, keyValues ...interface{}) {
+	l.log(LevelWarn, msg, keyValues)
+}
+
+// Error writes an error entry with key/value fields
+func (l *Logger) Error(msg string, keyValues ...interface{}) {
+	l.log(LevelError, msg, keyValues)
+}
+
+// log encodes the entry and writes it in one call
+func (l *Logger) log(level Level, msg string, keyValues []interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+	fields := append(append([]interface{}{}, l.fields...), keyValues...)
+	if len(fields)%2 == 1 {
+		fields = append(fields[:len(fields)-1], "!BADKEY", fields[len(fields)-1])
+	}
+
+	var buf bytes.Buffer
+	now := time.Now()
+	if l.format == JSONFormat {
+		buf.WriteString(`{"time":`)
+		writeJSON(&buf, now.Format(time.RFC3339Nano))
+		buf.WriteString(`,"level":`)
+		writeJSON(&buf, level.String())
+		buf.WriteString(`,"msg":`)
+		writeJSON(&buf, msg)
+		for i := 0; i < len(fields); i += 2 {
+			buf.WriteByte(',')
+			writeJSON(&buf, fmt.Sprint(fields[i]))
+			buf.WriteByte(':')
+			writeJSON(&buf, jsonValue(fields[i+1]))
+		}
+		buf.WriteString("}\n")
+	} else {
+		name := fmt.Sprintf("%-5s", strings.ToUpper(level.String()))
+		if l.color {
+			name = levelColors[level](name)
+		}
+		fmt.Fprintf(&buf, "%s %s %s", now.Format("2006/01/02 15:04:05"), name, msg)
+		for i := 0; i < len(fields); i += 2 {
+			fmt.Fprintf(&buf, " %v=%s", fields[i], textValue(fields[i+1]))
+		}
+		buf.WriteByte('\n')
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.out.Write(buf.Bytes())
+}
+
+// jsonValue converts the values that do not encode well as JSON
+func jsonValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case error:
+		return v.Error()
+	case time.Duration:
+		return v.String()
+	case fmt.Stringer:
+		return v.String()
+	}
+	return value
+}
+
+// writeJSON encodes the value, or its string form if it cannot be encoded
+func writeJSON(buf *bytes.Buffer, value interface{}) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprint(value))
+	}
+	buf.Write(data)
+}
+
+// textValue formats the value, quoted if it contains spaces
+func textValue(value interface{}) string {
+	text := fmt.Sprint(value)
+	if text == "" || strings.ContainsAny(text, " \t\n\"=") {
+		return fmt.Sprintf("%q", text)
+	}
+	return text
+}
+
+var (
+	defaultLock   sync.RWMutex
+	defaultLogger = NewLogger(os.Stderr, LevelOff, TextFormat)
+)
+
+// Default returns the logger used by the components created without a logger.
+// It is disabled until SetDefault is called
+func Default() *Logger {
+	defaultLock.RLock()
+	defer defaultLock.RUnlock()
+	return defaultLogger
+}
+
+// SetDefault replaces the default logger
+func SetDefault(logger *Logger) {
+	defaultLock.Lock()
+	defer defaultLock.Unlock()
+	defaultLogger = logger
+}
@@ -0,0 +1,29 @@
+package util
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// ShutdownTimeout bounds the time given to the open requests when a server stops
+var ShutdownTimeout = 10 * time.Second
+
+// ListenAndServe serves HTTP until the context is done, then shuts the server down gracefully
+func ListenAndServe(ctx context.Context, server *http.Server) error {
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		return xerrors.Errorf("fail to serve on %s: %s", server.Addr, err)
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+		defer cancel()
+		return server.Shutdown(shutdownCtx)
+	}
+}